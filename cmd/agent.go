@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/laminatedio/dendrite/internal/pkg/agent"
+)
+
+var agentTemplates []string
+var agentInterval time.Duration
+var agentOnce bool
+
+// agentCmd represents the agent command
+var agentCmd = &cobra.Command{
+	Use:   "agent --template <source:destination[:command]>...",
+	Short: "Render config files from templates and keep them up to date",
+	Long: `Render config files from templates and keep them up to date.
+
+Templates use the Go text/template syntax with these functions reading from the dendrite server:
+
+  value "/path"              current value of a path
+  values "/path"             all current values of a path
+  valueAt "/path" 3          value of a path at a version
+  valuesAt "/path" 3         all values of a path at a version
+  tree "/prefix"             map of every path under a prefix to its current values
+  join "," (values "/path")  values joined with a separator
+
+Outputs are replaced atomically and the command of a template is run through the shell whenever its output changes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		a := &agent.Agent{
+			Source:   newClient(),
+			Interval: agentInterval,
+			Logf: func(format string, args ...any) {
+				fmt.Fprintf(os.Stderr, "%s\t[INFO]\t%s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+			},
+		}
+		for _, spec := range agentTemplates {
+			t, err := agent.ParseTemplate(spec)
+			exitOnError(err, "invalid --template")
+			a.Templates = append(a.Templates, t)
+		}
+		if agentOnce {
+			a.Interval = 0
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		exitOnError(a.Run(ctx), "fail to render templates")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+	addClientFlags(agentCmd)
+	agentCmd.Flags().StringArrayVarP(&agentTemplates, "template", "t", nil, "template to render as source:destination[:command], can be repeated")
+	agentCmd.Flags().DurationVar(&agentInterval, "interval", 10*time.Second, "interval to poll for changed values")
+	agentCmd.Flags().BoolVar(&agentOnce, "once", false, "render the templates once and exit")
+	agentCmd.MarkFlagRequired("template")
+}
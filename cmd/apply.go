@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/astaclinic/astafx/logger"
+	"github.com/spf13/cobra"
+)
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Make the server match the declared config",
+	Long: `Make the server match the declared config.
+
+The plan is printed and then executed atomically: either every change is applied or none of them are.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		b, plan := newStatePlan(ctx)
+		defer b.Close(ctx)
+
+		if err := plan.Write(os.Stdout); err != nil {
+			logger.Fatalf("Fail to output plan: %v", err.Error())
+		}
+		if len(plan.Steps) == 0 {
+			return
+		}
+
+		if _, err := plan.Apply(ctx, b); err != nil {
+			logger.Fatalf("Fail to apply plan: %v", err.Error())
+		}
+		logger.Info("Apply successfully")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	addStateFlags(applyCmd)
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"fmt"
+
+	astafxConfig "github.com/astaclinic/astafx/config"
+	"go.uber.org/zap"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/config"
+)
+
+// newBackend connects to the backend in the config file, for commands working on the store directly instead of through the server
+func newBackend() (backend.Backend, error) {
+	astafxConfig.InitConfig(cfgFile)
+	config, err := config.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("fail to get config: %w", err)
+	}
+	// the query log of the backend is not interesting for command line usage
+	return backend.NewBackend(config.Backend, zap.NewNop().Sugar())
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/laminatedio/dendrite/pkg/client"
+)
+
+var clientConfig client.Config
+var outputFormat string
+
+func getEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// addClientFlags registers the flags of commands talking to a remote dendrite server
+func addClientFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&clientConfig.Endpoint, "endpoint", getEnv("DENDRITE_ENDPOINT", "http://localhost:8080"), "base URL of the dendrite server (env DENDRITE_ENDPOINT)")
+	cmd.Flags().StringVar(&clientConfig.Token, "token", "", "bearer token sent to the server (env DENDRITE_TOKEN)")
+	cmd.Flags().StringVar(&clientConfig.UserName, "user-name", "", "basic auth user name (env DENDRITE_USER_NAME)")
+	cmd.Flags().StringVar(&clientConfig.Password, "password", "", "basic auth password (env DENDRITE_PASSWORD)")
+	cmd.Flags().IntVar(&clientConfig.MaxRetries, "retries", 2, "number of retries of failed reads")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "plain", "output format, one of json, yaml or plain")
+}
+
+// newClient creates a client from the flags, credentials not given as flags are read from the environment
+// so that they are not shown as flag defaults in the help text
+func newClient() *client.Client {
+	config := clientConfig
+	if config.Token == "" {
+		config.Token = os.Getenv("DENDRITE_TOKEN")
+	}
+	if config.UserName == "" {
+		config.UserName = os.Getenv("DENDRITE_USER_NAME")
+	}
+	if config.Password == "" {
+		config.Password = os.Getenv("DENDRITE_PASSWORD")
+	}
+	return client.New(config)
+}
+
+func exitOnError(err error, message string) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\t[FATAL]\t%s: %v\n", time.Now().Format(time.RFC3339), message, err)
+		os.Exit(1)
+	}
+}
+
+// printOutput writes the output in the selected format, plain is used as is for the plain format
+func printOutput(output any, plain string) {
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(output, "", "  ")
+		exitOnError(err, "fail to encode output")
+		fmt.Println(string(data))
+	case "yaml":
+		data, err := yaml.Marshal(output)
+		exitOnError(err, "fail to encode output")
+		fmt.Print(string(data))
+	case "plain":
+		if plain != "" {
+			fmt.Println(plain)
+		}
+	default:
+		exitOnError(fmt.Errorf("unknown format %s", outputFormat), "fail to output")
+	}
+}
+
+// flatten converts a query result into sorted "path<TAB>value" lines
+func flatten(object map[string]any) string {
+	lines := []string{}
+	var walk func(base string, node any)
+	walk = func(base string, node any) {
+		switch node := node.(type) {
+		case map[string]any:
+			for key, child := range node {
+				walk(path.Join(base, key), child)
+			}
+		case []any:
+			for _, value := range node {
+				lines = append(lines, fmt.Sprintf("%s\t%v", base, value))
+			}
+		default:
+			lines = append(lines, fmt.Sprintf("%s\t%v", base, node))
+		}
+	}
+	walk("/", object)
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
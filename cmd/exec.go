@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/laminatedio/dendrite/internal/pkg/envexec"
+)
+
+var execPrefixes []string
+var execRules envexec.Rules
+var execInterval time.Duration
+var execOnChange string
+var execSignal string
+var execStopTimeout time.Duration
+
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec --prefix <path> -- <command> [args...]",
+	Short: "Run a command with config injected as environment variables",
+	Long: `Run a command with config injected as environment variables.
+
+Every path under the prefixes is exported as a variable named after the path relative to its prefix,
+upper cased with non alphanumeric characters replaced by underscores, e.g. /services/foo/db/host-name
+fetched with --prefix /services/foo becomes DB_HOST_NAME. Multiple values are joined with the separator.
+Paths of a prefix mapping to the same name, or to a name starting with a digit, are an error.
+
+With --watch the values are polled and the command is restarted or signaled when they change.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sig, ok := signals[strings.TrimPrefix(strings.ToUpper(execSignal), "SIG")]
+		if !ok {
+			exitOnError(fmt.Errorf("unknown signal %s", execSignal), "invalid --signal")
+		}
+		onChange := envexec.OnChange(execOnChange)
+		if onChange != envexec.OnChangeNone && onChange != envexec.OnChangeRestart && onChange != envexec.OnChangeSignal {
+			exitOnError(fmt.Errorf("unknown action %s", execOnChange), "invalid --on-change")
+		}
+
+		c := newClient()
+		runner := &envexec.Runner{
+			Command: args,
+			Fetch: func(ctx context.Context) ([]string, error) {
+				env := []string{}
+				for _, prefix := range execPrefixes {
+					values, err := c.Export(ctx, prefix)
+					if err != nil {
+						return nil, err
+					}
+					environ, err := execRules.Environ(prefix, values)
+					if err != nil {
+						return nil, err
+					}
+					env = append(env, environ...)
+				}
+				return env, nil
+			},
+			Interval:    execInterval,
+			OnChange:    onChange,
+			Signal:      sig,
+			StopTimeout: execStopTimeout,
+			Logf: func(format string, args ...any) {
+				fmt.Fprintf(os.Stderr, "%s\t[INFO]\t%s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+			},
+		}
+		code, err := runner.Run(context.Background())
+		exitOnError(err, "fail to run "+args[0])
+		os.Exit(code)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+	addClientFlags(execCmd)
+	execCmd.Flags().StringSliceVar(&execPrefixes, "prefix", nil, "path whose subtree is exported, later prefixes override earlier ones")
+	execCmd.Flags().StringVar(&execRules.Prefix, "env-prefix", "", "prefix prepended to every variable name")
+	execCmd.Flags().StringVar(&execRules.Separator, "separator", ",", "separator joining multiple values of a path")
+	execCmd.Flags().BoolVar(&execRules.KeepCase, "keep-case", false, "keep the case of the path instead of upper casing it")
+	execCmd.Flags().DurationVar(&execInterval, "watch", 0, "interval to poll for changed values, disabled when zero")
+	execCmd.Flags().StringVar(&execOnChange, "on-change", string(envexec.OnChangeRestart), "action when values change, one of restart, signal or none")
+	execCmd.Flags().StringVar(&execSignal, "signal", "HUP", "signal sent with --on-change signal")
+	execCmd.Flags().DurationVar(&execStopTimeout, "stop-timeout", 10*time.Second, "time a restarted command may take to exit before it is killed")
+	execCmd.MarkFlagRequired("prefix")
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var getVersion int
+
+// getCmd represents the get command
+var getCmd = &cobra.Command{
+	Use:   "get <path>",
+	Short: "Get the value of a path from a dendrite server",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := newClient()
+		var value string
+		var err error
+		if getVersion < 0 {
+			value, err = c.GetCurrent(context.Background(), args[0])
+		} else {
+			value, err = c.Get(context.Background(), args[0], getVersion)
+		}
+		exitOnError(err, "fail to get "+args[0])
+		printOutput(map[string]string{"value": value}, value)
+	},
+}
+
+// getManyCmd represents the get-many command
+var getManyCmd = &cobra.Command{
+	Use:   "get-many <path>",
+	Short: "Get all values of a path from a dendrite server",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := newClient()
+		var values []string
+		var err error
+		if getVersion < 0 {
+			values, err = c.GetManyCurrent(context.Background(), args[0])
+		} else {
+			values, err = c.GetMany(context.Background(), args[0], getVersion)
+		}
+		exitOnError(err, "fail to get "+args[0])
+		printOutput(map[string][]string{"values": values}, strings.Join(values, "\n"))
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{getCmd, getManyCmd} {
+		rootCmd.AddCommand(cmd)
+		addClientFlags(cmd)
+		cmd.Flags().IntVar(&getVersion, "version", -1, "version to get instead of the current one")
+	}
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history <path>",
+	Short: "List every version of a path",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		history, err := newClient().History(context.Background(), args[0])
+		exitOnError(err, "fail to get history of "+args[0])
+
+		lines := []string{}
+		for _, version := range history.Versions {
+			marker := " "
+			if version.Version == history.Metadata.CurrentVersion {
+				marker = "*"
+			}
+			lines = append(lines, fmt.Sprintf("%s %d\t%s", marker, version.Version, strings.Join(version.Values, ",")))
+		}
+		printOutput(history, strings.Join(lines, "\n"))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	addClientFlags(historyCmd)
+}
@@ -30,12 +30,100 @@ func newPostgresConn(config backend.PostgresConfig, root bool) (*pgxpool.Pool, e
 	return pgxpool.NewWithConfig(context.Background(), pgxconfig)
 }
 
+func migratePostgres(ctx context.Context, config backend.PostgresConfig) {
+	logger.Info("Connecting to postgres ...")
+	db, err := newPostgresConn(config, true)
+	if err != nil {
+		logger.Fatalf("Fail to get db conn: %v", err.Error())
+	}
+	defer db.Close()
+
+	logger.Info("Create database if not exist ...")
+	_, err = db.Exec(ctx, fmt.Sprintf("CREATE DATABASE %s", config.Database))
+	if err != nil {
+		var e *pgconn.PgError
+		// if the error is database existed
+		if errors.As(err, &e) && e.Code == "42P04" {
+			logger.Info("The database is already existed")
+		} else {
+			logger.Fatalf("Fail to init db: %v", err.Error())
+		}
+	}
+
+	logger.Info("Connecting to target postgres db ...")
+	dendriteDb, err := newPostgresConn(config, false)
+	if err != nil {
+		logger.Fatalf("Fail to get db conn: %v", err.Error())
+	}
+	defer dendriteDb.Close()
+
+	logger.Info("Create table if not exist ...")
+	_, err = dendriteDb.Exec(ctx, schema.GetSchema())
+	if err != nil {
+		logger.Fatalf("Fail to init table: %v", err.Error())
+	}
+}
+
+func migrateSQLite(ctx context.Context, config backend.SQLiteConfig) {
+	logger.Infof("Opening %s ...", config.Path)
+	db, err := backend.OpenSQLite(config)
+	if err != nil {
+		logger.Fatalf("Fail to open db: %v", err.Error())
+	}
+	defer db.Close()
+
+	logger.Info("Create table if not exist ...")
+	_, err = db.ExecContext(ctx, schema.GetSQLiteSchema())
+	if err != nil {
+		logger.Fatalf("Fail to init table: %v", err.Error())
+	}
+
+	logger.Info("Add column if not exist ...")
+	for _, column := range schema.GetSQLiteColumns() {
+		var count int
+		row := db.QueryRowContext(ctx, `SELECT count(*) FROM pragma_table_info(?) WHERE name = ?`, column.Table, column.Name)
+		if err := row.Scan(&count); err != nil {
+			logger.Fatalf("Fail to get the columns of %s: %v", column.Table, err.Error())
+		}
+		if count > 0 {
+			continue
+		}
+		_, err = db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", column.Table, column.Name, column.Definition))
+		if err != nil {
+			logger.Fatalf("Fail to add column %s to %s: %v", column.Name, column.Table, err.Error())
+		}
+	}
+
+	logger.Info("Index and backfill the added columns ...")
+	_, err = db.ExecContext(ctx, schema.GetSQLiteBackfill())
+	if err != nil {
+		logger.Fatalf("Fail to backfill: %v", err.Error())
+	}
+}
+
+// migrateBackend creates the tables of the backend and of every backend mounted under it
+func migrateBackend(ctx context.Context, config *backend.Config) {
+	switch config.Type {
+	case "postgres":
+		logger.Info("Starting for postgres DB migration ...")
+		migratePostgres(ctx, *config.Postgres)
+	case "sqlite":
+		logger.Info("Starting for sqlite DB migration ...")
+		migrateSQLite(ctx, *config.SQLite)
+	default:
+		logger.Infof("Backend %s has no schema to migrate", config.Type)
+	}
+	for _, mount := range config.Mounts {
+		logger.Infof("Migrating the backend mounted at %s ...", mount.Prefix)
+		migrateBackend(ctx, mount.Backend)
+	}
+}
+
 // migrateCmd represents the migrate command
 var migrateCmd = &cobra.Command{
 	Use:   "migrate",
-	Short: "Migration to postgres db",
+	Short: "Create the tables of the postgres or sqlite backend",
 	Run: func(cmd *cobra.Command, args []string) {
-		logger.Info("Starting for postgres DB migration ...")
 		ctx := context.Background()
 
 		logger.Info("Getting config ...")
@@ -45,39 +133,7 @@ var migrateCmd = &cobra.Command{
 			logger.Fatalf("Fail to get config: %v", err.Error())
 		}
 
-		logger.Info("Connecting to postgres ...")
-		db, err := newPostgresConn(config.Backend.Postgres, true)
-		if err != nil {
-			logger.Fatalf("Fail to get db conn: %v", err.Error())
-		}
-		defer db.Close()
-
-		logger.Info("Create database if not exist ...")
-		database := config.Backend.Postgres.Database
-		_, err = db.Exec(ctx, fmt.Sprintf("CREATE DATABASE %s", database))
-		if err != nil {
-			var e *pgconn.PgError
-			// if the error is database existed
-			if errors.As(err, &e) && e.Code == "42P04" {
-				logger.Info("The database is already existed")
-			} else {
-				logger.Fatalf("Fail to init db: %v", err.Error())
-			}
-		}
-
-		logger.Info("Connecting to target postgres db ...")
-		dendriteDb, err := newPostgresConn(config.Backend.Postgres, false)
-		if err != nil {
-			logger.Fatalf("Fail to get db conn: %v", err.Error())
-		}
-		defer dendriteDb.Close()
-
-		logger.Info("Create table if not exist ...")
-		schema := schema.GetSchema()
-		_, err = dendriteDb.Exec(ctx, schema)
-		if err != nil {
-			logger.Fatalf("Fail to init table: %v", err.Error())
-		}
+		migrateBackend(ctx, config.Backend)
 
 		logger.Info("Migrate successfully")
 	},
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/astaclinic/astafx/logger"
+	"github.com/spf13/cobra"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/state"
+)
+
+var declarationFiles []string
+var prunePrefixes []string
+
+// newStatePlan loads the declared tree and compares it with the backend
+func newStatePlan(ctx context.Context) (backend.Backend, *state.Plan) {
+	desired, err := state.Load(declarationFiles...)
+	if err != nil {
+		logger.Fatalf("Fail to load declarations: %v", err.Error())
+	}
+
+	b, err := newBackend()
+	if err != nil {
+		logger.Fatalf("Fail to connect to backend: %v", err.Error())
+	}
+
+	plan, err := state.NewPlan(ctx, b, desired, prunePrefixes)
+	if err != nil {
+		b.Close(ctx)
+		logger.Fatalf("Fail to plan: %v", err.Error())
+	}
+	return b, plan
+}
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the changes required to make the server match the declared config",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		b, plan := newStatePlan(ctx)
+		defer b.Close(ctx)
+
+		if err := plan.Write(os.Stdout); err != nil {
+			logger.Fatalf("Fail to output plan: %v", err.Error())
+		}
+	},
+}
+
+func addStateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVarP(&declarationFiles, "file", "f", nil, "YAML file or directory of YAML files declaring the config tree")
+	cmd.Flags().StringSliceVar(&prunePrefixes, "prune", nil, "managed prefix whose undeclared paths are deleted")
+	cmd.MarkFlagRequired("file")
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	addStateFlags(planCmd)
+}
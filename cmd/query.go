@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// queryCmd represents the query command
+var queryCmd = &cobra.Command{
+	Use:   "query [query]",
+	Short: "Run a GraphQL query against a dendrite server",
+	Long: `Run a GraphQL query against a dendrite server.
+
+The query is read from stdin when it is omitted or "-".
+The plain output lists every returned value as "path<TAB>value".`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var query string
+		if len(args) == 0 || args[0] == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			exitOnError(err, "fail to read query")
+			query = string(data)
+		} else {
+			query = args[0]
+		}
+		object, err := newClient().Query(context.Background(), query)
+		exitOnError(err, "fail to query")
+		printOutput(object, flatten(object))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(queryCmd)
+	addClientFlags(queryCmd)
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/laminatedio/dendrite/pkg/client"
+)
+
+var keepCurrent bool
+
+func metadataPlain(metadata *client.Metadata) string {
+	return fmt.Sprintf("%s\tlatest=%d\tcurrent=%d", metadata.Path, metadata.LatestVersion, metadata.CurrentVersion)
+}
+
+// setCmd represents the set command
+var setCmd = &cobra.Command{
+	Use:   "set <path> <value>",
+	Short: "Write a value as a new version of a path",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		metadata, err := newClient().Set(context.Background(), args[0], args[1], keepCurrent)
+		exitOnError(err, "fail to set "+args[0])
+		printOutput(metadata, metadataPlain(metadata))
+	},
+}
+
+// setManyCmd represents the set-many command
+var setManyCmd = &cobra.Command{
+	Use:   "set-many <path> <value>...",
+	Short: "Write values as a new version of a path",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		metadata, err := newClient().SetMany(context.Background(), args[0], args[1:], keepCurrent)
+		exitOnError(err, "fail to set "+args[0])
+		printOutput(metadata, metadataPlain(metadata))
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{setCmd, setManyCmd} {
+		rootCmd.AddCommand(cmd)
+		addClientFlags(cmd)
+		cmd.Flags().BoolVar(&keepCurrent, "keep-current", false, "keep the current version instead of promoting the new one")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/laminatedio/dendrite/internal/pkg/backend"
 	"github.com/laminatedio/dendrite/internal/pkg/config"
 	"github.com/laminatedio/dendrite/internal/pkg/dendrite"
+	"github.com/laminatedio/dendrite/internal/pkg/drift"
 )
 
 func New() *fx.App {
@@ -15,6 +16,7 @@ func New() *fx.App {
 		config.Module,
 		dendrite.Module,
 		backend.Module,
+		drift.Module,
 	)
 	return app
 }
@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Source reads config values, it is implemented by the dendrite client
+type Source interface {
+	GetCurrent(ctx context.Context, path string) (string, error)
+	Get(ctx context.Context, path string, version int) (string, error)
+	GetManyCurrent(ctx context.Context, path string) ([]string, error)
+	GetMany(ctx context.Context, path string, version int) ([]string, error)
+	Export(ctx context.Context, prefix string) (map[string][]string, error)
+}
+
+// Template is a text/template file rendered to Destination, Command is run through the shell after each change
+type Template struct {
+	Source      string
+	Destination string
+	Command     string
+	Perms       os.FileMode
+}
+
+// ParseTemplate parses the "source:destination[:command]" form of a template
+func ParseTemplate(spec string) (Template, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return Template{}, fmt.Errorf("invalid template %q, expected source:destination[:command]", spec)
+	}
+	t := Template{
+		Source:      parts[0],
+		Destination: parts[1],
+		Perms:       0644,
+	}
+	if len(parts) == 3 {
+		t.Command = parts[2]
+	}
+	return t, nil
+}
+
+// Agent renders templates with values from the source and re-renders them when the values change
+type Agent struct {
+	Source    Source
+	Templates []Template
+	// Interval between renders, templates are rendered once when zero
+	Interval time.Duration
+	Logf     func(format string, args ...any)
+}
+
+func (a *Agent) funcs(ctx context.Context) template.FuncMap {
+	return template.FuncMap{
+		// value returns the current value of a path
+		"value": func(path string) (string, error) {
+			return a.Source.GetCurrent(ctx, path)
+		},
+		// values returns all current values of a path
+		"values": func(path string) ([]string, error) {
+			return a.Source.GetManyCurrent(ctx, path)
+		},
+		// valueAt returns the value of a path at the given version
+		"valueAt": func(path string, version int) (string, error) {
+			return a.Source.Get(ctx, path, version)
+		},
+		// valuesAt returns all values of a path at the given version
+		"valuesAt": func(path string, version int) ([]string, error) {
+			return a.Source.GetMany(ctx, path, version)
+		},
+		// tree returns the current values of every path under a prefix
+		"tree": func(prefix string) (map[string][]string, error) {
+			return a.Source.Export(ctx, prefix)
+		},
+		"join": func(separator string, values []string) string {
+			return strings.Join(values, separator)
+		},
+	}
+}
+
+// Render renders the template, the output is only written when it differs from the existing file.
+// It reports whether the destination changed.
+func (a *Agent) Render(ctx context.Context, t Template) (bool, error) {
+	text, err := os.ReadFile(t.Source)
+	if err != nil {
+		return false, err
+	}
+	tmpl, err := template.New(filepath.Base(t.Source)).Option("missingkey=error").Funcs(a.funcs(ctx)).Parse(string(text))
+	if err != nil {
+		return false, err
+	}
+	var output bytes.Buffer
+	if err := tmpl.Execute(&output, nil); err != nil {
+		return false, err
+	}
+
+	existing, err := os.ReadFile(t.Destination)
+	if err == nil && bytes.Equal(existing, output.Bytes()) {
+		return false, nil
+	}
+	return true, writeAtomically(t.Destination, output.Bytes(), t.Perms)
+}
+
+// writeAtomically writes to a temporary file next to the destination and renames it over the destination,
+// so readers never see a partially written file
+func writeAtomically(destination string, data []byte, perms os.FileMode) error {
+	file, err := os.CreateTemp(filepath.Dir(destination), "."+filepath.Base(destination)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), perms); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), destination)
+}
+
+// RenderAll renders every template and runs the commands of the changed ones, each distinct command runs once
+func (a *Agent) RenderAll(ctx context.Context) error {
+	commands := []string{}
+	seen := map[string]bool{}
+	var failed error
+	for _, t := range a.Templates {
+		changed, err := a.Render(ctx, t)
+		if err != nil {
+			// other templates are still rendered, the destination of the failed one keeps its last good content
+			failed = fmt.Errorf("fail to render %s: %w", t.Source, err)
+			a.Logf("%v", failed)
+			continue
+		}
+		if changed {
+			a.Logf("rendered %s to %s", t.Source, t.Destination)
+			if t.Command != "" && !seen[t.Command] {
+				seen[t.Command] = true
+				commands = append(commands, t.Command)
+			}
+		}
+	}
+	for _, command := range commands {
+		output, err := exec.CommandContext(ctx, "sh", "-c", command).CombinedOutput()
+		if err != nil {
+			failed = fmt.Errorf("fail to run %q: %w: %s", command, err, output)
+			a.Logf("%v", failed)
+		}
+	}
+	return failed
+}
+
+// Run renders the templates every interval until ctx is done, or once when the interval is zero
+func (a *Agent) Run(ctx context.Context) error {
+	if a.Interval <= 0 {
+		return a.RenderAll(ctx)
+	}
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	for {
+		_ = a.RenderAll(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
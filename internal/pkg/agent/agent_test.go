@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+)
+
+type fakeSource map[string][]string
+
+func (s fakeSource) GetCurrent(ctx context.Context, path string) (string, error) {
+	values, err := s.GetManyCurrent(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return values[0], nil
+}
+
+func (s fakeSource) Get(ctx context.Context, path string, version int) (string, error) {
+	return s.GetCurrent(ctx, path)
+}
+
+func (s fakeSource) GetManyCurrent(ctx context.Context, path string) ([]string, error) {
+	values, ok := s[path]
+	if !ok {
+		return nil, &backend.NotFoundErr{Path: path}
+	}
+	return values, nil
+}
+
+func (s fakeSource) GetMany(ctx context.Context, path string, version int) ([]string, error) {
+	return s.GetManyCurrent(ctx, path)
+}
+
+func (s fakeSource) Export(ctx context.Context, prefix string) (map[string][]string, error) {
+	return s, nil
+}
+
+func TestAgent_RenderAll(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "nginx.conf.tmpl")
+	destination := filepath.Join(dir, "nginx.conf")
+	marker := filepath.Join(dir, "reloaded")
+	if err := os.WriteFile(source, []byte(`listen {{ value "/nginx/port" }};
+upstream { {{ join " " (values "/nginx/upstreams") }} }
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	values := fakeSource{
+		"/nginx/port":      {"80"},
+		"/nginx/upstreams": {"a", "b"},
+	}
+	a := &Agent{
+		Source: values,
+		Templates: []Template{
+			{Source: source, Destination: destination, Command: "echo >> " + marker, Perms: 0600},
+		},
+		Logf: t.Logf,
+	}
+
+	render := func(want string, wantReloads int) {
+		t.Helper()
+		if err := a.RenderAll(context.Background()); err != nil {
+			t.Fatalf("Agent.RenderAll() error = %v", err)
+		}
+		got, err := os.ReadFile(destination)
+		if err != nil || string(got) != want {
+			t.Errorf("rendered %q, %v, want %q", got, err, want)
+		}
+		reloads, _ := os.ReadFile(marker)
+		if len(reloads) != wantReloads {
+			t.Errorf("command ran %d times, want %d", len(reloads), wantReloads)
+		}
+	}
+
+	render("listen 80;\nupstream { a b }\n", 1)
+	// an unchanged output does not rerun the command
+	render("listen 80;\nupstream { a b }\n", 1)
+	values["/nginx/port"] = []string{"8080"}
+	render("listen 8080;\nupstream { a b }\n", 2)
+
+	// a failed render keeps the last good output
+	delete(values, "/nginx/port")
+	if err := a.RenderAll(context.Background()); err == nil {
+		t.Errorf("Agent.RenderAll() error = nil, want not found")
+	}
+	render2, _ := os.ReadFile(destination)
+	if string(render2) != "listen 8080;\nupstream { a b }\n" {
+		t.Errorf("rendered %q after failure, want the last good output", render2)
+	}
+}
@@ -2,7 +2,9 @@ package backend
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -16,6 +18,17 @@ func (err *NotFoundErr) Error() string {
 	return fmt.Sprintf("path %s not found", err.Path)
 }
 
+// ConflictErr is returned by writes expecting another latest version of the path than the stored one
+type ConflictErr struct {
+	Path            string
+	ExpectedVersion int
+	LatestVersion   int
+}
+
+func (err *ConflictErr) Error() string {
+	return fmt.Sprintf("path %s is at version %d, expected version %d", err.Path, err.LatestVersion, err.ExpectedVersion)
+}
+
 type Record struct {
 	Value string
 	Metadata
@@ -27,10 +40,39 @@ type Metadata struct {
 	CurrentVersion int
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
+	// Revision is the global revision of the write of the latest version
+	Revision int
 }
 
 type SetOptions struct {
 	KeepCurrent bool
+	// ExpectedVersion makes the write fail with a *ConflictErr unless it is the latest version of the path,
+	// 0 expects the path not to exist
+	ExpectedVersion *int
+}
+
+// checkExpectedVersion returns a *ConflictErr when options expect another latest version of path than latest
+func checkExpectedVersion(path string, latest int, options SetOptions) error {
+	if options.ExpectedVersion != nil && *options.ExpectedVersion != latest {
+		return &ConflictErr{Path: path, ExpectedVersion: *options.ExpectedVersion, LatestVersion: latest}
+	}
+	return nil
+}
+
+// Change is a mutation of a single path applied as part of a Batch.
+// A Change either writes Values as a new version or, when Delete is set, removes the path. The versions of a deleted path
+// remain for the reads at the times and revisions before the delete, until the path is written again from the first version.
+type Change struct {
+	Path    string
+	Values  []string
+	Delete  bool
+	Options SetOptions
+}
+
+// Selection is a version of a path to read, Version -1 selects the current version
+type Selection struct {
+	Path    string
+	Version int
 }
 
 type SetMetaDataOptions struct {
@@ -38,25 +80,94 @@ type SetMetaDataOptions struct {
 	LatestVersion  int
 }
 
+// ErrRevisionsUnsupported is returned by backends without a single revision counter
+var ErrRevisionsUnsupported = errors.New("revisions are not supported by this backend")
+
 type Backend interface {
 	GetCurrent(ctx context.Context, path string) (string, error)
 	Get(ctx context.Context, path string, version int) (string, error)
 	GetManyCurrent(ctx context.Context, path string) ([]string, error)
 	GetMany(ctx context.Context, path string, version int) ([]string, error)
+	// GetManyPaths returns the values of every selection in a single round trip, in the order of selections.
+	// Like GetMany, the values are empty when the path or version does not exist.
+	GetManyPaths(ctx context.Context, selections []Selection) ([][]string, error)
 	Set(ctx context.Context, path string, value string, options SetOptions) (*Metadata, error)
 	SetMany(ctx context.Context, path string, values []string, options SetOptions) (*Metadata, error)
+	GetMetadata(ctx context.Context, path string) (*Metadata, error)
+	// GetManyMetadata returns the metadata of every path in a single round trip, in the order of paths.
+	// The metadata is nil when the path does not exist.
+	GetManyMetadata(ctx context.Context, paths []string) ([]*Metadata, error)
+	// GetVersionsAt returns the version of each path which was current at the given time, in the order of paths.
+	// The version is 0 when the path had no current version then, which reads as empty like a missing version.
+	GetVersionsAt(ctx context.Context, paths []string, at time.Time) ([]int, error)
+	// Revision returns the latest global revision, which every call of SetMany or Batch increments once, 0 before any write
+	Revision(ctx context.Context) (int, error)
+	// GetVersionsAtRevision returns the version of each path which was current after the write of revision, like GetVersionsAt
+	GetVersionsAtRevision(ctx context.Context, paths []string, revision int) ([]int, error)
+	// List returns the metadata of the prefix itself and every path below it, ordered by path
+	List(ctx context.Context, prefix string) ([]Metadata, error)
+	// Batch applies all changes atomically, returning the metadata of each written path (deleted paths are omitted)
+	Batch(ctx context.Context, changes []Change) ([]Metadata, error)
 	Close(ctx context.Context) error
 }
 
+// HasPathPrefix reports whether path is prefix itself or lies below it
+func HasPathPrefix(path string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
 type Config struct {
-	Type     string         `mapstructure:"type" validate:"required"`
-	Postgres PostgresConfig `mapstructure:"postgres"`
+	// Type is one of postgres, memory, bolt, sqlite, redis or git
+	Type     string          `mapstructure:"type" validate:"required,oneof=postgres memory bolt sqlite redis git"`
+	Postgres *PostgresConfig `mapstructure:"postgres" validate:"required_if=Type postgres"`
+	Bolt     *BoltConfig     `mapstructure:"bolt" validate:"required_if=Type bolt"`
+	SQLite   *SQLiteConfig   `mapstructure:"sqlite" validate:"required_if=Type sqlite"`
+	Redis    *RedisConfig    `mapstructure:"redis" validate:"required_if=Type redis"`
+	Git      *GitConfig      `mapstructure:"git" validate:"required_if=Type git"`
+	// Mounts store the paths under their prefixes in other backends, this backend keeps every other path.
+	// With mounts a batch, e.g. an apply or a mutation, must write the paths of a single mount,
+	// and reads at a revision are not supported as every mount counts its own revisions.
+	Mounts []MountConfig `mapstructure:"mounts" validate:"dive"`
 }
 
 func NewBackend(config *Config, logger *zap.SugaredLogger) (Backend, error) {
+	root, err := newBackend(config, logger)
+	if err != nil || len(config.Mounts) == 0 {
+		return root, err
+	}
+	mounts := []Mount{{Prefix: "/", Backend: root}}
+	for _, mount := range config.Mounts {
+		child, err := NewBackend(mount.Backend, logger)
+		if err != nil {
+			(&RouterBackend{mounts: mounts}).Close(context.Background())
+			return nil, fmt.Errorf("failed to create the backend of %s: %w", mount.Prefix, err)
+		}
+		mounts = append(mounts, Mount{Prefix: mount.Prefix, Backend: child})
+	}
+	router, err := NewRouterBackend(mounts)
+	if err != nil {
+		(&RouterBackend{mounts: mounts}).Close(context.Background())
+		return nil, err
+	}
+	logger.Warnf("%d backends are mounted, reads at a revision are not supported and batches must write the paths of a single mount", len(config.Mounts))
+	return router, nil
+}
+
+func newBackend(config *Config, logger *zap.SugaredLogger) (Backend, error) {
 	switch config.Type {
 	case "postgres":
-		return NewPostgresBackend(config.Postgres, logger)
+		return NewPostgresBackend(*config.Postgres, logger)
+	case "memory":
+		return NewMemoryBackend(), nil
+	case "bolt":
+		return NewBoltBackend(*config.Bolt)
+	case "sqlite":
+		return NewSQLiteBackend(*config.SQLite)
+	case "redis":
+		return NewRedisBackend(*config.Redis)
+	case "git":
+		return NewGitBackend(*config.Git)
 	}
 	return nil, fmt.Errorf("backend %s not implemented", config.Type)
 }
@@ -0,0 +1,412 @@
+// Package backendtest is the conformance suite every backend.Backend implementation is expected to pass.
+//
+//	var _ = Describe("Memory", func() {
+//		backendtest.Conformance(func(ctx context.Context) backend.Backend {
+//			return backend.NewMemoryBackend()
+//		})
+//	})
+package backendtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+)
+
+// Conformance declares the specs of the suite in the enclosing container.
+// newBackend is called before every spec and must return an empty backend, which is closed after the spec.
+func Conformance(newBackend func(ctx context.Context) backend.Backend) {
+	var b backend.Backend
+
+	BeforeEach(func(ctx context.Context) {
+		b = newBackend(ctx)
+	})
+
+	AfterEach(func(ctx context.Context) {
+		Expect(b.Close(ctx)).To(Succeed())
+	})
+
+	Describe("a path which does not exist", func() {
+		path := "/some/nonexist/path"
+
+		It("should return not found errors for single values and metadata", func(ctx context.Context) {
+			var notFoundErr *backend.NotFoundErr
+			_, err := b.GetCurrent(ctx, path)
+			Expect(errors.As(err, &notFoundErr)).To(BeTrue())
+			Expect(notFoundErr.Path).To(Equal(path))
+			_, err = b.Get(ctx, path, 1)
+			Expect(errors.As(err, &notFoundErr)).To(BeTrue())
+			_, err = b.GetMetadata(ctx, path)
+			Expect(errors.As(err, &notFoundErr)).To(BeTrue())
+		})
+
+		It("should return no values", func(ctx context.Context) {
+			Expect(b.GetManyCurrent(ctx, path)).To(BeEmpty())
+			Expect(b.GetMany(ctx, path, 1)).To(BeEmpty())
+			Expect(b.GetManyPaths(ctx, []backend.Selection{{Path: path, Version: -1}})).To(Equal([][]string{{}}))
+		})
+
+		It("should not be listed", func(ctx context.Context) {
+			Expect(b.List(ctx, path)).To(BeEmpty())
+		})
+	})
+
+	Describe("versioning", func() {
+		path := "/some/test/path"
+
+		It("should number the versions from 1 and keep the values of each of them in order", func(ctx context.Context) {
+			for i, values := range [][]string{{"b", "a", "c"}, {"x"}, {"z", "y"}} {
+				metadata, err := b.SetMany(ctx, path, values, backend.SetOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(metadata.Path).To(Equal(path))
+				Expect(metadata.LatestVersion).To(Equal(i + 1))
+				Expect(metadata.CurrentVersion).To(Equal(i + 1))
+			}
+			Expect(b.GetMany(ctx, path, 1)).To(Equal([]string{"b", "a", "c"}))
+			Expect(b.Get(ctx, path, 2)).To(Equal("x"))
+			Expect(b.GetManyCurrent(ctx, path)).To(Equal([]string{"z", "y"}))
+			Expect(b.GetCurrent(ctx, path)).To(Equal("z"))
+		})
+
+		It("should return not found errors for versions which do not exist", func(ctx context.Context) {
+			Expect(b.Set(ctx, path, "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			var notFoundErr *backend.NotFoundErr
+			for _, version := range []int{0, 2} {
+				_, err := b.Get(ctx, path, version)
+				Expect(errors.As(err, &notFoundErr)).To(BeTrue())
+				Expect(b.GetMany(ctx, path, version)).To(BeEmpty())
+			}
+		})
+
+		It("should keep the creation time and move the update time", func(ctx context.Context) {
+			first, err := b.Set(ctx, path, "1", backend.SetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(first.CreatedAt).NotTo(BeZero())
+			second, err := b.Set(ctx, path, "2", backend.SetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			metadata, err := b.GetMetadata(ctx, path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.CreatedAt).To(BeTemporally("~", first.CreatedAt))
+			Expect(metadata.UpdatedAt).To(BeTemporally("~", second.UpdatedAt))
+			Expect(metadata.UpdatedAt).NotTo(BeTemporally("<", metadata.CreatedAt))
+		})
+	})
+
+	Describe("GetManyPaths", func() {
+		It("should return the values of every selection in order", func(ctx context.Context) {
+			Expect(b.SetMany(ctx, "/a", []string{"2", "1"}, backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(b.SetMany(ctx, "/a", []string{"3"}, backend.SetOptions{KeepCurrent: true})).Error().NotTo(HaveOccurred())
+			Expect(b.SetMany(ctx, "/b", []string{"4"}, backend.SetOptions{})).Error().NotTo(HaveOccurred())
+
+			Expect(b.GetManyPaths(ctx, []backend.Selection{
+				{Path: "/b", Version: -1},
+				{Path: "/a", Version: -1},
+				{Path: "/a", Version: 2},
+				{Path: "/a", Version: 3},
+				{Path: "/c", Version: -1},
+				{Path: "/b", Version: 1},
+			})).To(Equal([][]string{{"4"}, {"2", "1"}, {"3"}, {}, {}, {"4"}}))
+		})
+
+		It("should accept no selections", func(ctx context.Context) {
+			Expect(b.GetManyPaths(ctx, []backend.Selection{})).To(BeEmpty())
+		})
+	})
+
+	Describe("GetManyMetadata", func() {
+		It("should return the metadata of every path in order", func(ctx context.Context) {
+			Expect(b.SetMany(ctx, "/a", []string{"1"}, backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(b.SetMany(ctx, "/a", []string{"2"}, backend.SetOptions{KeepCurrent: true})).Error().NotTo(HaveOccurred())
+			Expect(b.SetMany(ctx, "/b", []string{"3"}, backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			a, err := b.GetMetadata(ctx, "/a")
+			Expect(err).NotTo(HaveOccurred())
+			bMetadata, err := b.GetMetadata(ctx, "/b")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(b.GetManyMetadata(ctx, []string{"/b", "/missing", "/a", "/b"})).To(Equal([]*backend.Metadata{bMetadata, nil, a, bMetadata}))
+		})
+
+		It("should accept no paths", func(ctx context.Context) {
+			Expect(b.GetManyMetadata(ctx, []string{})).To(BeEmpty())
+		})
+	})
+
+	Describe("KeepCurrent", func() {
+		path := "/some/test/path"
+
+		It("should add a version without changing the current one", func(ctx context.Context) {
+			Expect(b.Set(ctx, path, "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			metadata, err := b.Set(ctx, path, "2", backend.SetOptions{KeepCurrent: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.LatestVersion).To(Equal(2))
+			Expect(metadata.CurrentVersion).To(Equal(1))
+			Expect(b.GetCurrent(ctx, path)).To(Equal("1"))
+			Expect(b.Get(ctx, path, 2)).To(Equal("2"))
+
+			metadata, err = b.GetMetadata(ctx, path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.LatestVersion).To(Equal(2))
+			Expect(metadata.CurrentVersion).To(Equal(1))
+		})
+
+		It("should leave a new path without a current version", func(ctx context.Context) {
+			metadata, err := b.Set(ctx, path, "1", backend.SetOptions{KeepCurrent: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.LatestVersion).To(Equal(1))
+			Expect(metadata.CurrentVersion).To(Equal(0))
+			var notFoundErr *backend.NotFoundErr
+			_, err = b.GetCurrent(ctx, path)
+			Expect(errors.As(err, &notFoundErr)).To(BeTrue())
+			Expect(b.Get(ctx, path, 1)).To(Equal("1"))
+		})
+	})
+
+	Describe("List", func() {
+		BeforeEach(func(ctx context.Context) {
+			for _, path := range []string{"/b", "/a/b/c", "/ab", "/a", "/a/c", "/a/b"} {
+				Expect(b.Set(ctx, path, "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			}
+		})
+
+		It("should return the prefix and the paths below it ordered by path", func(ctx context.Context) {
+			for _, prefix := range []string{"/a", "/a/"} {
+				list, err := b.List(ctx, prefix)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(paths(list)).To(Equal([]string{"/a", "/a/b", "/a/b/c", "/a/c"}))
+			}
+		})
+
+		It("should return every path under the root", func(ctx context.Context) {
+			list, err := b.List(ctx, "/")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(HaveLen(6))
+			Expect(list[0].LatestVersion).To(Equal(1))
+		})
+	})
+
+	Describe("Batch", func() {
+		It("should apply the changes in order and return the metadata of the written paths", func(ctx context.Context) {
+			Expect(b.SetMany(ctx, "/a", []string{"1", "2"}, backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(b.Set(ctx, "/b", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			result, err := b.Batch(ctx, []backend.Change{
+				{Path: "/c", Values: []string{"1"}},
+				{Path: "/a", Delete: true},
+				{Path: "/b", Values: []string{"2"}, Options: backend.SetOptions{KeepCurrent: true}},
+				{Path: "/c", Values: []string{"2"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths(result)).To(Equal([]string{"/c", "/b", "/c"}))
+			Expect(result[1].LatestVersion).To(Equal(2))
+			Expect(result[1].CurrentVersion).To(Equal(1))
+			Expect(result[2].LatestVersion).To(Equal(2))
+
+			Expect(b.GetManyCurrent(ctx, "/a")).To(BeEmpty())
+			Expect(b.GetMetadata(ctx, "/a")).Error().To(HaveOccurred())
+			Expect(b.GetCurrent(ctx, "/b")).To(Equal("1"))
+			Expect(b.GetCurrent(ctx, "/c")).To(Equal("2"))
+			list, err := b.List(ctx, "/")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths(list)).To(Equal([]string{"/b", "/c"}))
+		})
+
+		It("should start a deleted path again from the first version", func(ctx context.Context) {
+			Expect(b.SetMany(ctx, "/a", []string{"1"}, backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(b.SetMany(ctx, "/a", []string{"2"}, backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(b.Batch(ctx, []backend.Change{{Path: "/a", Delete: true}})).To(BeEmpty())
+			metadata, err := b.Set(ctx, "/a", "3", backend.SetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.LatestVersion).To(Equal(1))
+			Expect(b.Get(ctx, "/a", 1)).To(Equal("3"))
+			Expect(b.GetMany(ctx, "/a", 2)).To(BeEmpty())
+		})
+	})
+
+	Describe("ExpectedVersion", func() {
+		version := func(v int) *int { return &v }
+
+		It("should write when the latest version is the expected one", func(ctx context.Context) {
+			metadata, err := b.Set(ctx, "/a", "1", backend.SetOptions{ExpectedVersion: version(0)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.LatestVersion).To(Equal(1))
+			metadata, err = b.SetMany(ctx, "/a", []string{"2"}, backend.SetOptions{ExpectedVersion: version(1)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.LatestVersion).To(Equal(2))
+		})
+
+		It("should reject the write with a conflict otherwise", func(ctx context.Context) {
+			Expect(b.Set(ctx, "/a", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			_, err := b.Set(ctx, "/a", "2", backend.SetOptions{ExpectedVersion: version(0)})
+			var conflictErr *backend.ConflictErr
+			Expect(errors.As(err, &conflictErr)).To(BeTrue())
+			Expect(*conflictErr).To(Equal(backend.ConflictErr{Path: "/a", ExpectedVersion: 0, LatestVersion: 1}))
+			Expect(b.GetCurrent(ctx, "/a")).To(Equal("1"))
+
+			_, err = b.Set(ctx, "/b", "1", backend.SetOptions{ExpectedVersion: version(1)})
+			Expect(errors.As(err, &conflictErr)).To(BeTrue())
+			Expect(b.GetMetadata(ctx, "/b")).Error().To(BeAssignableToTypeOf(&backend.NotFoundErr{}))
+		})
+
+		It("should apply no change of a batch with a conflict", func(ctx context.Context) {
+			Expect(b.Set(ctx, "/a", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			_, err := b.Batch(ctx, []backend.Change{
+				{Path: "/b", Values: []string{"1"}},
+				{Path: "/a", Values: []string{"2"}, Options: backend.SetOptions{ExpectedVersion: version(1)}},
+				{Path: "/a", Values: []string{"3"}, Options: backend.SetOptions{ExpectedVersion: version(1)}},
+			})
+			var conflictErr *backend.ConflictErr
+			Expect(errors.As(err, &conflictErr)).To(BeTrue())
+			Expect(conflictErr.LatestVersion).To(Equal(2))
+			Expect(b.GetCurrent(ctx, "/a")).To(Equal("1"))
+			Expect(b.List(ctx, "/b")).To(BeEmpty())
+		})
+	})
+
+	Describe("GetVersionsAt", func() {
+		It("should return the version which was current at each time", func(ctx context.Context) {
+			first, err := b.Set(ctx, "/a", "1", backend.SetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			second, err := b.Set(ctx, "/a", "2", backend.SetOptions{KeepCurrent: true})
+			Expect(err).NotTo(HaveOccurred())
+			third, err := b.Set(ctx, "/a", "3", backend.SetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			paths := []string{"/a", "/missing"}
+			Expect(b.GetVersionsAt(ctx, paths, first.UpdatedAt.Add(-time.Millisecond))).To(Equal([]int{0, 0}))
+			Expect(b.GetVersionsAt(ctx, paths, first.UpdatedAt)).To(Equal([]int{1, 0}))
+			Expect(b.GetVersionsAt(ctx, paths, second.UpdatedAt)).To(Equal([]int{1, 0}))
+			Expect(b.GetVersionsAt(ctx, paths, third.UpdatedAt)).To(Equal([]int{3, 0}))
+			Expect(b.GetVersionsAt(ctx, []string{}, third.UpdatedAt)).To(BeEmpty())
+		})
+
+		It("should return no version of a deleted path after the delete", func(ctx context.Context) {
+			Expect(b.Set(ctx, "/a", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(b.Batch(ctx, []backend.Change{{Path: "/a", Delete: true}})).Error().NotTo(HaveOccurred())
+			Expect(b.GetVersionsAt(ctx, []string{"/a"}, time.Now())).To(Equal([]int{0}))
+		})
+	})
+
+	Describe("revisions", func() {
+		BeforeEach(func(ctx context.Context) {
+			if _, err := b.Revision(ctx); errors.Is(err, backend.ErrRevisionsUnsupported) {
+				Skip("revisions are not supported")
+			}
+		})
+
+		It("should increment the revision once for every write", func(ctx context.Context) {
+			Expect(b.Revision(ctx)).To(Equal(0))
+			metadata, err := b.Set(ctx, "/a", "1", backend.SetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.Revision).To(Equal(1))
+
+			result, err := b.Batch(ctx, []backend.Change{{Path: "/a", Values: []string{"2"}}, {Path: "/b", Values: []string{"3"}}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result[0].Revision).To(Equal(2))
+			Expect(result[1].Revision).To(Equal(2))
+			Expect(b.Revision(ctx)).To(Equal(2))
+			Expect(b.GetMetadata(ctx, "/b")).To(HaveField("Revision", 2))
+
+			expected := 1
+			Expect(b.Set(ctx, "/a", "4", backend.SetOptions{ExpectedVersion: &expected})).Error().To(HaveOccurred())
+			Expect(b.Batch(ctx, []backend.Change{})).Error().NotTo(HaveOccurred())
+			Expect(b.Revision(ctx)).To(Equal(2))
+		})
+
+		It("should return the version which was current at each revision", func(ctx context.Context) {
+			Expect(b.Set(ctx, "/a", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(b.Set(ctx, "/b", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(b.Set(ctx, "/a", "2", backend.SetOptions{KeepCurrent: true})).Error().NotTo(HaveOccurred())
+			Expect(b.Batch(ctx, []backend.Change{{Path: "/a", Values: []string{"3"}}, {Path: "/b", Values: []string{"2"}}})).Error().NotTo(HaveOccurred())
+
+			paths := []string{"/a", "/b", "/missing"}
+			Expect(b.GetVersionsAtRevision(ctx, paths, 0)).To(Equal([]int{0, 0, 0}))
+			Expect(b.GetVersionsAtRevision(ctx, paths, 1)).To(Equal([]int{1, 0, 0}))
+			Expect(b.GetVersionsAtRevision(ctx, paths, 3)).To(Equal([]int{1, 1, 0}))
+			Expect(b.GetVersionsAtRevision(ctx, paths, 4)).To(Equal([]int{3, 2, 0}))
+			Expect(b.GetVersionsAtRevision(ctx, []string{}, 4)).To(BeEmpty())
+		})
+
+		It("should keep the versions of a deleted path for the revisions before the delete", func(ctx context.Context) {
+			Expect(b.Set(ctx, "/a", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(b.Set(ctx, "/b", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(b.Batch(ctx, []backend.Change{{Path: "/a", Delete: true}})).Error().NotTo(HaveOccurred())
+			Expect(b.Batch(ctx, []backend.Change{{Path: "/b", Values: []string{"2"}}, {Path: "/b", Delete: true}})).Error().NotTo(HaveOccurred())
+
+			paths := []string{"/a", "/b"}
+			Expect(b.GetVersionsAtRevision(ctx, paths, 2)).To(Equal([]int{1, 1}))
+			Expect(b.GetVersionsAtRevision(ctx, paths, 3)).To(Equal([]int{0, 1}))
+			Expect(b.GetVersionsAtRevision(ctx, paths, 4)).To(Equal([]int{0, 0}))
+			Expect(b.GetMany(ctx, "/a", 1)).To(Equal([]string{"1"}))
+			Expect(b.GetManyCurrent(ctx, "/a")).To(BeEmpty())
+		})
+
+		It("should forget the versions of a deleted path once it is written again", func(ctx context.Context) {
+			Expect(b.Set(ctx, "/a", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(b.Batch(ctx, []backend.Change{{Path: "/a", Delete: true}})).Error().NotTo(HaveOccurred())
+			Expect(b.Set(ctx, "/a", "2", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+
+			Expect(b.GetVersionsAtRevision(ctx, []string{"/a"}, 1)).To(Equal([]int{0}))
+			Expect(b.GetVersionsAtRevision(ctx, []string{"/a"}, 3)).To(Equal([]int{1}))
+			Expect(b.Get(ctx, "/a", 1)).To(Equal("2"))
+		})
+	})
+
+	Describe("concurrency", func() {
+		It("should give every concurrent write of a path its own version", func(ctx context.Context) {
+			path := "/some/concurrent/path"
+			writes := 20
+			var wg sync.WaitGroup
+			for i := 0; i < writes; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					Expect(b.Set(ctx, path, fmt.Sprint(i), backend.SetOptions{})).Error().NotTo(HaveOccurred())
+				}(i)
+			}
+			wg.Wait()
+
+			metadata, err := b.GetMetadata(ctx, path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.LatestVersion).To(Equal(writes))
+			Expect(metadata.CurrentVersion).To(Equal(writes))
+			seen := map[string]bool{}
+			for version := 1; version <= writes; version++ {
+				values, err := b.GetMany(ctx, path, version)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(values).To(HaveLen(1))
+				seen[values[0]] = true
+			}
+			Expect(seen).To(HaveLen(writes))
+		})
+
+		It("should not lose concurrent writes of different paths", func(ctx context.Context) {
+			writes := 20
+			var wg sync.WaitGroup
+			for i := 0; i < writes; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					Expect(b.SetMany(ctx, fmt.Sprintf("/concurrent/%02d", i), []string{fmt.Sprint(i)}, backend.SetOptions{})).Error().NotTo(HaveOccurred())
+				}(i)
+			}
+			wg.Wait()
+			Expect(b.List(ctx, "/concurrent")).To(HaveLen(writes))
+		})
+	})
+}
+
+func paths(list []backend.Metadata) []string {
+	result := []string{}
+	for _, metadata := range list {
+		result = append(result, metadata.Path)
+	}
+	return result
+}
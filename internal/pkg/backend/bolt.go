@@ -0,0 +1,415 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type BoltConfig struct {
+	// Path of the database file, created when it does not exist
+	Path string `mapstructure:"path" validate:"required"`
+}
+
+var (
+	boltMetadataBucket = []byte("metadata")
+	boltValuesBucket   = []byte("values")
+	boltCurrentBucket  = []byte("current")
+)
+
+// BoltBackend stores the config in a single bbolt file, for deployments without an external database.
+// Every write is a bbolt transaction synced to disk before it returns, so the file is consistent after a crash.
+//
+// The metadata bucket maps each path to its JSON encoded Metadata, and the values bucket maps
+// path + "\x00" + big endian version to the JSON encoded values of that version. The current bucket maps
+// the same keys to the JSON encoded boltCurrentVersion of the versions which became current, and of the delete of the path.
+// The sequence of the metadata bucket is the global revision.
+type BoltBackend struct {
+	DB *bolt.DB
+}
+
+func NewBoltBackend(config BoltConfig) (Backend, error) {
+	db, err := bolt.Open(config.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", config.Path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltMetadataBucket, boltValuesBucket, boltCurrentBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltBackend{DB: db}, nil
+}
+
+// boltDeletedVersion is the version under which the current bucket records the delete of a path, after its versions
+const boltDeletedVersion = math.MaxInt64
+
+// boltCurrentVersion records when a version became current
+type boltCurrentVersion struct {
+	At       time.Time `json:"at"`
+	Revision int       `json:"revision"`
+}
+
+func boltValuesKey(path string, version int) []byte {
+	key := make([]byte, len(path)+9)
+	copy(key, path)
+	binary.BigEndian.PutUint64(key[len(path)+1:], uint64(version))
+	return key
+}
+
+func boltGetMetadata(tx *bolt.Tx, path string) (*Metadata, error) {
+	data := tx.Bucket(boltMetadataBucket).Get([]byte(path))
+	if data == nil {
+		return nil, &NotFoundErr{Path: path}
+	}
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("corrupted metadata of %s: %w", path, err)
+	}
+	return &metadata, nil
+}
+
+func boltGetMany(tx *bolt.Tx, path string, version int) ([]string, error) {
+	result := []string{}
+	data := tx.Bucket(boltValuesBucket).Get(boltValuesKey(path, version))
+	if data == nil {
+		return result, nil
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("corrupted values of %s: %w", path, err)
+	}
+	return result, nil
+}
+
+func (b *BoltBackend) GetCurrent(ctx context.Context, path string) (string, error) {
+	result, err := b.GetManyCurrent(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if len(result) < 1 {
+		return "", &NotFoundErr{Path: path}
+	}
+	return result[0], nil
+}
+
+func (b *BoltBackend) Get(ctx context.Context, path string, version int) (string, error) {
+	result, err := b.GetMany(ctx, path, version)
+	if err != nil {
+		return "", err
+	}
+	if len(result) < 1 {
+		return "", &NotFoundErr{Path: path}
+	}
+	return result[0], nil
+}
+
+func (b *BoltBackend) GetManyCurrent(ctx context.Context, path string) ([]string, error) {
+	result := []string{}
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		metadata, err := boltGetMetadata(tx, path)
+		var notFoundErr *NotFoundErr
+		if errors.As(err, &notFoundErr) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		result, err = boltGetMany(tx, path, metadata.CurrentVersion)
+		return err
+	})
+	return result, err
+}
+
+func (b *BoltBackend) GetMany(ctx context.Context, path string, version int) ([]string, error) {
+	var result []string
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		result, err = boltGetMany(tx, path, version)
+		return err
+	})
+	return result, err
+}
+
+func (b *BoltBackend) GetManyPaths(ctx context.Context, selections []Selection) ([][]string, error) {
+	result := make([][]string, len(selections))
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		for i, selection := range selections {
+			version := selection.Version
+			if version == -1 {
+				metadata, err := boltGetMetadata(tx, selection.Path)
+				var notFoundErr *NotFoundErr
+				if errors.As(err, &notFoundErr) {
+					result[i] = []string{}
+					continue
+				} else if err != nil {
+					return err
+				}
+				version = metadata.CurrentVersion
+			}
+			values, err := boltGetMany(tx, selection.Path, version)
+			if err != nil {
+				return err
+			}
+			result[i] = values
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *BoltBackend) Set(ctx context.Context, path, value string, options SetOptions) (*Metadata, error) {
+	return b.SetMany(ctx, path, []string{value}, options)
+}
+
+func (b *BoltBackend) SetMany(ctx context.Context, path string, values []string, options SetOptions) (*Metadata, error) {
+	var metadata *Metadata
+	err := b.DB.Update(func(tx *bolt.Tx) error {
+		revision, err := tx.Bucket(boltMetadataBucket).NextSequence()
+		if err != nil {
+			return err
+		}
+		metadata, err = b.setMany(tx, path, values, options, int(revision))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+func (b *BoltBackend) setMany(tx *bolt.Tx, path string, values []string, options SetOptions, revision int) (*Metadata, error) {
+	now := time.Now()
+	metadata, err := boltGetMetadata(tx, path)
+	var notFoundErr *NotFoundErr
+	if errors.As(err, &notFoundErr) {
+		metadata = &Metadata{
+			Path:      path,
+			CreatedAt: now,
+		}
+		// the path starts again from the first version, so the versions of a deleted path are forgotten
+		if err := boltForget(tx, path); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if err := checkExpectedVersion(path, metadata.LatestVersion, options); err != nil {
+		return nil, err
+	}
+	metadata.LatestVersion++
+	if !options.KeepCurrent {
+		metadata.CurrentVersion = metadata.LatestVersion
+	}
+	metadata.UpdatedAt = now
+	metadata.Revision = revision
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Bucket(boltValuesBucket).Put(boltValuesKey(path, metadata.LatestVersion), data); err != nil {
+		return nil, err
+	}
+	if !options.KeepCurrent {
+		data, err := json.Marshal(boltCurrentVersion{At: now, Revision: revision})
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Bucket(boltCurrentBucket).Put(boltValuesKey(path, metadata.CurrentVersion), data); err != nil {
+			return nil, err
+		}
+	}
+	data, err = json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Bucket(boltMetadataBucket).Put([]byte(path), data); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// delete removes the metadata of path and records the delete as the last current version, under boltDeletedVersion.
+// The versions are kept for the reads before the delete, until the path is written again.
+func (b *BoltBackend) delete(tx *bolt.Tx, path string, revision int) error {
+	if tx.Bucket(boltMetadataBucket).Get([]byte(path)) == nil {
+		return nil
+	}
+	if err := tx.Bucket(boltMetadataBucket).Delete([]byte(path)); err != nil {
+		return err
+	}
+	data, err := json.Marshal(boltCurrentVersion{At: time.Now(), Revision: revision})
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltCurrentBucket).Put(boltValuesKey(path, boltDeletedVersion), data)
+}
+
+// boltForget removes the values and current versions of path
+func boltForget(tx *bolt.Tx, path string) error {
+	prefix := append([]byte(path), 0)
+	for _, bucket := range [][]byte{boltValuesBucket, boltCurrentBucket} {
+		cursor := tx.Bucket(bucket).Cursor()
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Seek(prefix) {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *BoltBackend) GetMetadata(ctx context.Context, path string) (*Metadata, error) {
+	var metadata *Metadata
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		metadata, err = boltGetMetadata(tx, path)
+		return err
+	})
+	return metadata, err
+}
+
+func (b *BoltBackend) GetManyMetadata(ctx context.Context, paths []string) ([]*Metadata, error) {
+	result := make([]*Metadata, len(paths))
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		for i, path := range paths {
+			metadata, err := boltGetMetadata(tx, path)
+			var notFoundErr *NotFoundErr
+			if errors.As(err, &notFoundErr) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			result[i] = metadata
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (b *BoltBackend) GetVersionsAt(ctx context.Context, paths []string, at time.Time) ([]int, error) {
+	return b.getVersions(paths, func(current boltCurrentVersion) bool {
+		return !current.At.After(at)
+	})
+}
+
+func (b *BoltBackend) Revision(ctx context.Context) (int, error) {
+	var revision uint64
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		revision = tx.Bucket(boltMetadataBucket).Sequence()
+		return nil
+	})
+	return int(revision), err
+}
+
+func (b *BoltBackend) GetVersionsAtRevision(ctx context.Context, paths []string, revision int) ([]int, error) {
+	return b.getVersions(paths, func(current boltCurrentVersion) bool {
+		return current.Revision <= revision
+	})
+}
+
+// getVersions returns the last version of each path which became current before, as reported by before
+func (b *BoltBackend) getVersions(paths []string, before func(boltCurrentVersion) bool) ([]int, error) {
+	result := make([]int, len(paths))
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(boltCurrentBucket).Cursor()
+		for i, path := range paths {
+			// the keys of a path are ordered by version, which is the order the versions became current
+			prefix := append([]byte(path), 0)
+			for key, data := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, data = cursor.Next() {
+				var current boltCurrentVersion
+				if err := json.Unmarshal(data, &current); err != nil {
+					return fmt.Errorf("corrupted current version of %s: %w", path, err)
+				}
+				if !before(current) {
+					break
+				}
+				result[i] = 0
+				if version := binary.BigEndian.Uint64(key[len(prefix):]); version != boltDeletedVersion {
+					result[i] = int(version)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *BoltBackend) List(ctx context.Context, prefix string) ([]Metadata, error) {
+	result := []Metadata{}
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		// keys are sorted, so every path under the prefix follows the prefix itself
+		start := []byte(strings.TrimSuffix(prefix, "/"))
+		cursor := tx.Bucket(boltMetadataBucket).Cursor()
+		for key, data := cursor.Seek(start); key != nil && bytes.HasPrefix(key, start); key, data = cursor.Next() {
+			if !HasPathPrefix(string(key), prefix) {
+				continue
+			}
+			var metadata Metadata
+			if err := json.Unmarshal(data, &metadata); err != nil {
+				return fmt.Errorf("corrupted metadata of %s: %w", key, err)
+			}
+			result = append(result, metadata)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *BoltBackend) Batch(ctx context.Context, changes []Change) ([]Metadata, error) {
+	result := []Metadata{}
+	err := b.DB.Update(func(tx *bolt.Tx) error {
+		if len(changes) == 0 {
+			return nil
+		}
+		revision, err := tx.Bucket(boltMetadataBucket).NextSequence()
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			if change.Delete {
+				if err := b.delete(tx, change.Path, int(revision)); err != nil {
+					return fmt.Errorf("failed to delete %s: %w", change.Path, err)
+				}
+				continue
+			}
+			metadata, err := b.setMany(tx, change.Path, change.Values, change.Options, int(revision))
+			if err != nil {
+				return fmt.Errorf("failed to set %s: %w", change.Path, err)
+			}
+			result = append(result, *metadata)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *BoltBackend) Close(context.Context) error {
+	return b.DB.Close()
+}
@@ -0,0 +1,40 @@
+package backend_test
+
+import (
+	"context"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/backend/backendtest"
+)
+
+var _ = Describe("Bolt", func() {
+	backendtest.Conformance(func(ctx context.Context) backend.Backend {
+		boltBackend, err := backend.NewBoltBackend(backend.BoltConfig{Path: filepath.Join(GinkgoT().TempDir(), "dendrite.db")})
+		Expect(err).NotTo(HaveOccurred())
+		return boltBackend
+	})
+
+	It("should keep the versions after reopening the file", func(ctx context.Context) {
+		config := backend.BoltConfig{Path: filepath.Join(GinkgoT().TempDir(), "dendrite.db")}
+		boltBackend, err := backend.NewBoltBackend(config)
+		Expect(err).NotTo(HaveOccurred())
+		path := "/some/test/path"
+		Expect(boltBackend.SetMany(ctx, path, []string{"a", "b"}, backend.SetOptions{})).Error().NotTo(HaveOccurred())
+		Expect(boltBackend.Set(ctx, path, "c", backend.SetOptions{KeepCurrent: true})).Error().NotTo(HaveOccurred())
+		Expect(boltBackend.Close(ctx)).To(Succeed())
+
+		boltBackend, err = backend.NewBoltBackend(config)
+		Expect(err).NotTo(HaveOccurred())
+		defer boltBackend.Close(ctx)
+		Expect(boltBackend.GetManyCurrent(ctx, path)).To(Equal([]string{"a", "b"}))
+		Expect(boltBackend.Get(ctx, path, 2)).To(Equal("c"))
+		metadata, err := boltBackend.GetMetadata(ctx, path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metadata.LatestVersion).To(Equal(2))
+		Expect(metadata.CurrentVersion).To(Equal(1))
+	})
+})
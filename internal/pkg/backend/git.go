@@ -0,0 +1,766 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+type GitConfig struct {
+	// Path of the bare repository, initialized when it does not exist
+	Path string `mapstructure:"path" validate:"required"`
+	// AuthorName and AuthorEmail sign the commits, "dendrite" and "dendrite@localhost" when empty
+	AuthorName  string `mapstructure:"author_name"`
+	AuthorEmail string `mapstructure:"author_email"`
+}
+
+const (
+	gitLatestBranch  = plumbing.ReferenceName("refs/heads/main")
+	gitCurrentBranch = plumbing.ReferenceName("refs/heads/current")
+	gitFileSuffix    = ".json"
+	// gitRevisionTrailer precedes the global revision in the last line of the commit messages
+	gitRevisionTrailer = "Revision: "
+)
+
+// gitFile is the content of the file of a path, the version makes every write a change of the file
+type gitFile struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Revision  int       `json:"revision,omitempty"`
+	Values    []string  `json:"values"`
+}
+
+// GitBackend stores the config in a bare Git repository, so the history can be browsed with git itself.
+//
+// Path /a/b is the file a/b.json, and every write is a commit on the main branch. The versions of a path are
+// the commits of main which changed its file, since it was last deleted, or before the delete while it is not written again. The current branch holds the current
+// version of every path, and moves along with main except for writes with KeepCurrent. Both commits of a write end
+// with a trailer holding the global revision, which commits written before revisions lack. A path cannot have a
+// child whose segment is its own last segment with the .json suffix, as the file and the directory would clash.
+//
+// Writes are serialized within the process, the repository must not be written by other processes.
+type GitBackend struct {
+	Repository *git.Repository
+	author     object.Signature
+	mutex      sync.RWMutex
+}
+
+func NewGitBackend(config GitConfig) (Backend, error) {
+	repository, err := git.PlainOpen(config.Path)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		repository, err = git.PlainInit(config.Path, true)
+		if err == nil {
+			err = repository.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, gitLatestBranch))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", config.Path, err)
+	}
+	author := object.Signature{Name: config.AuthorName, Email: config.AuthorEmail}
+	if author.Name == "" {
+		author.Name = "dendrite"
+	}
+	if author.Email == "" {
+		author.Email = "dendrite@localhost"
+	}
+	return &GitBackend{Repository: repository, author: author}, nil
+}
+
+// gitFilePath returns the file of path in the repository
+func gitFilePath(path string) (string, error) {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if !strings.HasPrefix(path, "/") || path == "/" {
+		return "", fmt.Errorf("invalid path %s", path)
+	}
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." || segment == ".git" {
+			return "", fmt.Errorf("invalid path %s", path)
+		}
+	}
+	return strings.Join(segments, "/") + gitFileSuffix, nil
+}
+
+// commit returns the commit of branch, or nil when the branch has no commit yet
+func (b *GitBackend) commit(branch plumbing.ReferenceName) (*object.Commit, error) {
+	ref, err := b.Repository.Reference(branch, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return b.Repository.CommitObject(ref.Hash())
+}
+
+// readFile reads the file of path in commit, or returns nil when it does not exist
+func readFile(commit *object.Commit, file string) (*gitFile, error) {
+	if commit == nil {
+		return nil, nil
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	f, err := tree.File(file)
+	if errors.Is(err, object.ErrFileNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return nil, err
+	}
+	var result gitFile
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return nil, fmt.Errorf("corrupted file %s: %w", file, err)
+	}
+	return &result, nil
+}
+
+func (b *GitBackend) readBranch(branch plumbing.ReferenceName, path string) (*gitFile, error) {
+	file, err := gitFilePath(path)
+	if err != nil {
+		return nil, nil
+	}
+	commit, err := b.commit(branch)
+	if err != nil {
+		return nil, err
+	}
+	return readFile(commit, file)
+}
+
+func (b *GitBackend) GetCurrent(ctx context.Context, path string) (string, error) {
+	result, err := b.GetManyCurrent(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if len(result) < 1 {
+		return "", &NotFoundErr{Path: path}
+	}
+	return result[0], nil
+}
+
+func (b *GitBackend) Get(ctx context.Context, path string, version int) (string, error) {
+	result, err := b.GetMany(ctx, path, version)
+	if err != nil {
+		return "", err
+	}
+	if len(result) < 1 {
+		return "", &NotFoundErr{Path: path}
+	}
+	return result[0], nil
+}
+
+func (b *GitBackend) GetManyCurrent(ctx context.Context, path string) ([]string, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	current, err := b.readBranch(gitCurrentBranch, path)
+	if err != nil || current == nil {
+		return []string{}, err
+	}
+	return current.Values, nil
+}
+
+func (b *GitBackend) GetMany(ctx context.Context, path string, version int) ([]string, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	file, err := gitFilePath(path)
+	if err != nil {
+		return []string{}, nil
+	}
+	return b.getMany(file, version)
+}
+
+// getMany returns the values of version of file in the history of main, b.mutex must be held
+func (b *GitBackend) getMany(file string, version int) ([]string, error) {
+	head, err := b.commit(gitLatestBranch)
+	if err != nil || head == nil {
+		return []string{}, err
+	}
+	latest, err := readFile(head, file)
+	if err != nil || version < 1 || (latest != nil && version > latest.Version) {
+		return []string{}, err
+	}
+	if latest != nil && version == latest.Version {
+		return latest.Values, nil
+	}
+	// a deleted path keeps its versions until it is written again, they are read from the commits before the delete
+	deleted := latest == nil
+
+	commits, err := b.Repository.Log(&git.LogOptions{From: head.Hash, FileName: &file})
+	if err != nil {
+		return nil, err
+	}
+	defer commits.Close()
+	for {
+		commit, err := commits.Next()
+		if errors.Is(err, io.EOF) {
+			return []string{}, nil
+		} else if err != nil {
+			return nil, err
+		}
+		f, err := readFile(commit, file)
+		if err != nil {
+			return nil, err
+		}
+		if f == nil && deleted {
+			continue
+		}
+		deleted = false
+		// the file was deleted before this commit, the versions before it belong to the deleted path
+		if f == nil || f.Version < version {
+			return []string{}, nil
+		}
+		if f.Version == version {
+			return f.Values, nil
+		}
+	}
+}
+
+// GetManyPaths reads every selection from the same commits of main and current
+func (b *GitBackend) GetManyPaths(ctx context.Context, selections []Selection) ([][]string, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	current, err := b.commit(gitCurrentBranch)
+	if err != nil {
+		return nil, err
+	}
+	result := make([][]string, len(selections))
+	for i, selection := range selections {
+		result[i] = []string{}
+		file, err := gitFilePath(selection.Path)
+		if err != nil {
+			continue
+		}
+		if selection.Version != -1 {
+			if result[i], err = b.getMany(file, selection.Version); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		f, err := readFile(current, file)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			result[i] = f.Values
+		}
+	}
+	return result, nil
+}
+
+func (b *GitBackend) Set(ctx context.Context, path, value string, options SetOptions) (*Metadata, error) {
+	return b.SetMany(ctx, path, []string{value}, options)
+}
+
+func (b *GitBackend) SetMany(ctx context.Context, path string, values []string, options SetOptions) (*Metadata, error) {
+	result, err := b.Batch(ctx, []Change{{Path: path, Values: values, Options: options}})
+	if err != nil {
+		return nil, err
+	}
+	return &result[0], nil
+}
+
+func (b *GitBackend) metadata(path string, latest, current *gitFile) Metadata {
+	metadata := Metadata{
+		Path:          path,
+		LatestVersion: latest.Version,
+		CreatedAt:     latest.CreatedAt,
+		UpdatedAt:     latest.UpdatedAt,
+		Revision:      latest.Revision,
+	}
+	if current != nil {
+		metadata.CurrentVersion = current.Version
+	}
+	return metadata
+}
+
+func (b *GitBackend) GetMetadata(ctx context.Context, path string) (*Metadata, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	latest, err := b.readBranch(gitLatestBranch, path)
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return nil, &NotFoundErr{Path: path}
+	}
+	current, err := b.readBranch(gitCurrentBranch, path)
+	if err != nil {
+		return nil, err
+	}
+	metadata := b.metadata(path, latest, current)
+	return &metadata, nil
+}
+
+// GetManyMetadata reads every path from the same commits of main and current
+func (b *GitBackend) GetManyMetadata(ctx context.Context, paths []string) ([]*Metadata, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	latestCommit, err := b.commit(gitLatestBranch)
+	if err != nil {
+		return nil, err
+	}
+	currentCommit, err := b.commit(gitCurrentBranch)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Metadata, len(paths))
+	for i, path := range paths {
+		file, err := gitFilePath(path)
+		if err != nil {
+			continue
+		}
+		latest, err := readFile(latestCommit, file)
+		if err != nil {
+			return nil, err
+		}
+		if latest == nil {
+			continue
+		}
+		current, err := readFile(currentCommit, file)
+		if err != nil {
+			return nil, err
+		}
+		metadata := b.metadata(path, latest, current)
+		result[i] = &metadata
+	}
+	return result, nil
+}
+
+// GetVersionsAt walks the history of the current branch, whose files were each written as the version became current.
+// Commit times only have a precision of a second, so the time of the file decides within the second,
+// while a deletion counts from the start of its second.
+func (b *GitBackend) GetVersionsAt(ctx context.Context, paths []string, at time.Time) ([]int, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	result := make([]int, len(paths))
+	files := map[int]string{}
+	for i, path := range paths {
+		if file, err := gitFilePath(path); err == nil {
+			files[i] = file
+		}
+	}
+	head, err := b.commit(gitLatestBranch)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := b.commit(gitCurrentBranch)
+	if err != nil {
+		return nil, err
+	}
+	for commit != nil && len(files) > 0 {
+		if !commit.Committer.When.After(at) {
+			for i, file := range files {
+				f, err := readFile(commit, file)
+				if err != nil {
+					return nil, err
+				}
+				// a missing file was deleted or not written yet, which resolves the path as well
+				if f == nil || !f.UpdatedAt.After(at) {
+					if result[i], err = resolvedVersion(head, file, f); err != nil {
+						return nil, err
+					}
+					delete(files, i)
+				}
+			}
+		}
+		if commit.NumParents() == 0 {
+			break
+		}
+		if commit, err = commit.Parent(0); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// gitCommitRevision returns the global revision in the trailer of commit, 0 when there is no commit or trailer
+func gitCommitRevision(commit *object.Commit) (int, error) {
+	if commit == nil {
+		return 0, nil
+	}
+	lines := strings.Split(strings.TrimSuffix(commit.Message, "\n"), "\n")
+	last := lines[len(lines)-1]
+	if !strings.HasPrefix(last, gitRevisionTrailer) {
+		return 0, nil
+	}
+	revision, err := strconv.Atoi(strings.TrimPrefix(last, gitRevisionTrailer))
+	if err != nil {
+		return 0, fmt.Errorf("corrupted revision of commit %s: %w", commit.Hash, err)
+	}
+	return revision, nil
+}
+
+func (b *GitBackend) Revision(ctx context.Context) (int, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	head, err := b.commit(gitLatestBranch)
+	if err != nil {
+		return 0, err
+	}
+	return gitCommitRevision(head)
+}
+
+// GetVersionsAtRevision reads the files of the last commit of the current branch written at or before revision
+func (b *GitBackend) GetVersionsAtRevision(ctx context.Context, paths []string, revision int) ([]int, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	result := make([]int, len(paths))
+	head, err := b.commit(gitLatestBranch)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := b.commit(gitCurrentBranch)
+	if err != nil {
+		return nil, err
+	}
+	for commit != nil {
+		commitRevision, err := gitCommitRevision(commit)
+		if err != nil {
+			return nil, err
+		}
+		if commitRevision <= revision {
+			break
+		}
+		if commit.NumParents() == 0 {
+			return result, nil
+		}
+		if commit, err = commit.Parent(0); err != nil {
+			return nil, err
+		}
+	}
+	for i, path := range paths {
+		file, err := gitFilePath(path)
+		if err != nil {
+			continue
+		}
+		f, err := readFile(commit, file)
+		if err != nil {
+			return nil, err
+		}
+		if result[i], err = resolvedVersion(head, file, f); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// resolvedVersion returns the version of f, read from an earlier commit of the current branch, or 0 when there is no file
+// or the path has been deleted and written again since then, as its versions started again from the first one
+func resolvedVersion(head *object.Commit, file string, f *gitFile) (int, error) {
+	if f == nil {
+		return 0, nil
+	}
+	latest, err := readFile(head, file)
+	if err != nil {
+		return 0, err
+	}
+	if latest != nil && !latest.CreatedAt.Equal(f.CreatedAt) {
+		return 0, nil
+	}
+	return f.Version, nil
+}
+
+func (b *GitBackend) List(ctx context.Context, prefix string) ([]Metadata, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	result := []Metadata{}
+	head, err := b.commit(gitLatestBranch)
+	if err != nil || head == nil {
+		return result, err
+	}
+	tree, err := head.Tree()
+	if err != nil {
+		return nil, err
+	}
+	current, err := b.commit(gitCurrentBranch)
+	if err != nil {
+		return nil, err
+	}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		path := "/" + strings.TrimSuffix(f.Name, gitFileSuffix)
+		if !strings.HasSuffix(f.Name, gitFileSuffix) || !HasPathPrefix(path, prefix) {
+			return nil
+		}
+		latest, err := readFile(head, f.Name)
+		if err != nil {
+			return err
+		}
+		currentFile, err := readFile(current, f.Name)
+		if err != nil {
+			return err
+		}
+		result = append(result, b.metadata(path, latest, currentFile))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// Batch writes all changes as a single commit on main, and another one on current when the current versions change
+func (b *GitBackend) Batch(ctx context.Context, changes []Change) ([]Metadata, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+
+	head, err := b.commit(gitLatestBranch)
+	if err != nil {
+		return nil, err
+	}
+	current, err := b.commit(gitCurrentBranch)
+	if err != nil {
+		return nil, err
+	}
+	revision, err := gitCommitRevision(head)
+	if err != nil {
+		return nil, err
+	}
+	// every change adds a line to the message of main, so the revision is only written along with a change
+	revision++
+	latestTree, currentTree := treeHash(head), treeHash(current)
+	// files written by earlier changes of the batch, which are not in the trees of the commits yet
+	written := map[string]*gitFile{}
+	currentWritten := map[string]*gitFile{}
+
+	result := []Metadata{}
+	message := []string{}
+	currentMessage := []string{}
+	for _, change := range changes {
+		file, err := gitFilePath(change.Path)
+		if err != nil {
+			return nil, err
+		}
+		if change.Delete {
+			if latestTree, err = b.setTreeEntry(latestTree, file, plumbing.ZeroHash); err != nil {
+				return nil, fmt.Errorf("failed to delete %s: %w", change.Path, err)
+			}
+			if currentTree, err = b.setTreeEntry(currentTree, file, plumbing.ZeroHash); err != nil {
+				return nil, fmt.Errorf("failed to delete %s: %w", change.Path, err)
+			}
+			written[file], currentWritten[file] = nil, nil
+			message = append(message, "delete "+change.Path)
+			currentMessage = append(currentMessage, "delete "+change.Path)
+			continue
+		}
+
+		previous, ok := written[file]
+		if !ok {
+			if previous, err = readFile(head, file); err != nil {
+				return nil, err
+			}
+		}
+		latest := 0
+		if previous != nil {
+			latest = previous.Version
+		}
+		// nothing is committed yet, so a conflict leaves both branches as they are
+		if err := checkExpectedVersion(change.Path, latest, change.Options); err != nil {
+			return nil, err
+		}
+		values := change.Values
+		if values == nil {
+			values = []string{}
+		}
+		next := &gitFile{Version: 1, CreatedAt: now, UpdatedAt: now, Revision: revision, Values: values}
+		if previous != nil {
+			next.Version, next.CreatedAt = previous.Version+1, previous.CreatedAt
+		}
+		blob, err := b.writeBlob(next)
+		if err != nil {
+			return nil, err
+		}
+		if latestTree, err = b.setTreeEntry(latestTree, file, blob); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", change.Path, err)
+		}
+		written[file] = next
+		message = append(message, fmt.Sprintf("set %s to version %d", change.Path, next.Version))
+
+		currentFile, ok := currentWritten[file]
+		if !ok {
+			if currentFile, err = readFile(current, file); err != nil {
+				return nil, err
+			}
+		}
+		if !change.Options.KeepCurrent {
+			if currentTree, err = b.setTreeEntry(currentTree, file, blob); err != nil {
+				return nil, fmt.Errorf("failed to set %s: %w", change.Path, err)
+			}
+			currentFile = next
+			currentWritten[file] = next
+			currentMessage = append(currentMessage, fmt.Sprintf("set %s to version %d", change.Path, next.Version))
+		}
+		result = append(result, b.metadata(change.Path, next, currentFile))
+	}
+
+	if len(message) > 0 {
+		if err := b.writeCommit(gitLatestBranch, head, latestTree, message, revision, now); err != nil {
+			return nil, err
+		}
+	}
+	if len(currentMessage) > 0 {
+		if err := b.writeCommit(gitCurrentBranch, current, currentTree, currentMessage, revision, now); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func treeHash(commit *object.Commit) plumbing.Hash {
+	if commit == nil {
+		return plumbing.ZeroHash
+	}
+	return commit.TreeHash
+}
+
+func (b *GitBackend) writeBlob(file *gitFile) (plumbing.Hash, error) {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	obj := b.Repository.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		w.Close()
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return b.Repository.Storer.SetEncodedObject(obj)
+}
+
+// setTreeEntry writes the trees from the root to the file, with the file pointing to blob or removed when blob is zero.
+// It returns the new root, which is zero when the tree became empty.
+func (b *GitBackend) setTreeEntry(root plumbing.Hash, file string, blob plumbing.Hash) (plumbing.Hash, error) {
+	entries := []object.TreeEntry{}
+	if !root.IsZero() {
+		tree, err := object.GetTree(b.Repository.Storer, root)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		entries = append(entries, tree.Entries...)
+	}
+	name, rest, isDir := strings.Cut(file, "/")
+	index := -1
+	for i, entry := range entries {
+		if entry.Name == name {
+			index = i
+		}
+	}
+
+	entry := object.TreeEntry{Name: name, Mode: filemode.Regular, Hash: blob}
+	if isDir {
+		child := plumbing.ZeroHash
+		if index >= 0 {
+			if entries[index].Mode != filemode.Dir {
+				return plumbing.ZeroHash, fmt.Errorf("%s is a file", name)
+			}
+			child = entries[index].Hash
+		}
+		hash, err := b.setTreeEntry(child, rest, blob)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		entry = object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: hash}
+	} else if index >= 0 && entries[index].Mode == filemode.Dir {
+		return plumbing.ZeroHash, fmt.Errorf("%s is a directory", name)
+	}
+
+	if index >= 0 {
+		entries = append(entries[:index], entries[index+1:]...)
+	}
+	if !entry.Hash.IsZero() {
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return plumbing.ZeroHash, nil
+	}
+	// git orders the entries as if directories had a trailing slash
+	sort.Slice(entries, func(i, j int) bool {
+		return gitEntryName(entries[i]) < gitEntryName(entries[j])
+	})
+	obj := b.Repository.Storer.NewEncodedObject()
+	if err := (&object.Tree{Entries: entries}).Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return b.Repository.Storer.SetEncodedObject(obj)
+}
+
+func gitEntryName(entry object.TreeEntry) string {
+	if entry.Mode == filemode.Dir {
+		return entry.Name + "/"
+	}
+	return entry.Name
+}
+
+func (b *GitBackend) writeCommit(branch plumbing.ReferenceName, parent *object.Commit, tree plumbing.Hash, message []string, revision int, now time.Time) error {
+	if tree.IsZero() {
+		// the root tree of a commit must exist even when it is empty
+		obj := b.Repository.Storer.NewEncodedObject()
+		if err := (&object.Tree{}).Encode(obj); err != nil {
+			return err
+		}
+		var err error
+		if tree, err = b.Repository.Storer.SetEncodedObject(obj); err != nil {
+			return err
+		}
+	}
+	author := b.author
+	author.When = now
+	commit := &object.Commit{
+		Author:    author,
+		Committer: author,
+		TreeHash:  tree,
+	}
+	var buffer bytes.Buffer
+	if len(message) == 1 {
+		fmt.Fprintln(&buffer, message[0])
+	} else {
+		fmt.Fprintf(&buffer, "apply %d changes\n\n", len(message))
+		for _, line := range message {
+			fmt.Fprintln(&buffer, line)
+		}
+	}
+	fmt.Fprintf(&buffer, "\n%s%d\n", gitRevisionTrailer, revision)
+	commit.Message = buffer.String()
+	if parent != nil {
+		commit.ParentHashes = []plumbing.Hash{parent.Hash}
+	}
+	obj := b.Repository.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return err
+	}
+	hash, err := b.Repository.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return err
+	}
+	return b.Repository.Storer.SetReference(plumbing.NewHashReference(branch, hash))
+}
+
+func (b *GitBackend) Close(context.Context) error {
+	return nil
+}
@@ -0,0 +1,76 @@
+package backend_test
+
+import (
+	"context"
+	"os/exec"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/backend/backendtest"
+)
+
+var _ = Describe("Git", func() {
+	backendtest.Conformance(func(ctx context.Context) backend.Backend {
+		gitBackend, err := backend.NewGitBackend(backend.GitConfig{Path: GinkgoT().TempDir()})
+		Expect(err).NotTo(HaveOccurred())
+		return gitBackend
+	})
+
+	Describe("the repository", func() {
+		var config backend.GitConfig
+		var gitBackend backend.Backend
+
+		BeforeEach(func() {
+			var err error
+			config = backend.GitConfig{Path: GinkgoT().TempDir()}
+			gitBackend, err = backend.NewGitBackend(config)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func(ctx context.Context) {
+			Expect(gitBackend.Close(ctx)).To(Succeed())
+		})
+
+		It("should map the versions to the commits of the file", func(ctx context.Context) {
+			path := "/some/test/path"
+			Expect(gitBackend.SetMany(ctx, path, []string{"b", "a"}, backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(gitBackend.Set(ctx, "/some/other/path", "x", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(gitBackend.Set(ctx, path, "b", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			metadata, err := gitBackend.Set(ctx, path, "c", backend.SetOptions{KeepCurrent: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.LatestVersion).To(Equal(3))
+			Expect(metadata.CurrentVersion).To(Equal(2))
+
+			Expect(gitBackend.GetManyCurrent(ctx, path)).To(Equal([]string{"b"}))
+			Expect(gitBackend.GetMany(ctx, path, 1)).To(Equal([]string{"b", "a"}))
+			Expect(gitBackend.Get(ctx, path, 3)).To(Equal("c"))
+			Expect(gitBackend.GetMany(ctx, path, 4)).To(BeEmpty())
+
+			// reopening reads everything back from the repository
+			gitBackend, err = backend.NewGitBackend(config)
+			Expect(err).NotTo(HaveOccurred())
+			metadata, err = gitBackend.GetMetadata(ctx, path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.LatestVersion).To(Equal(3))
+			Expect(metadata.CurrentVersion).To(Equal(2))
+		})
+
+		It("should be readable with git", func(ctx context.Context) {
+			if _, err := exec.LookPath("git"); err != nil {
+				Skip("git is not installed")
+			}
+			Expect(gitBackend.Set(ctx, "/a/b", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(gitBackend.Set(ctx, "/a/b", "2", backend.SetOptions{KeepCurrent: true})).Error().NotTo(HaveOccurred())
+
+			output, err := exec.Command("git", "-C", config.Path, "log", "--format=%s", "main", "--", "a/b.json").Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(output)).To(Equal("set /a/b to version 2\nset /a/b to version 1\n"))
+			output, err = exec.Command("git", "-C", config.Path, "show", "current:a/b.json").Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(output)).To(ContainSubstring(`"version": 1`))
+			Expect(exec.Command("git", "-C", config.Path, "fsck", "--strict").Run()).To(Succeed())
+		})
+	})
+})
@@ -2,19 +2,41 @@ package backend
 
 import (
 	"context"
-	"errors"
+	"sort"
+	"sync"
 	"time"
 )
 
+// MemoryBackend keeps every version in memory, it follows the behaviour of PostgresBackend and is safe for concurrent use.
+// Everything is lost when the process exits, so it is meant for development and tests.
 type MemoryBackend struct {
-	Config   map[string]map[int][]string
-	Metadata map[string]Metadata
+	mutex    sync.RWMutex
+	values   map[string]map[int][]string
+	metadata map[string]Metadata
+	// currents holds the versions of each path in the order they became current
+	currents map[string][]currentVersion
+	revision int
+}
+
+// currentVersion records when a version became current
+type currentVersion struct {
+	Version  int
+	At       time.Time
+	Revision int
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		values:   make(map[string]map[int][]string),
+		metadata: make(map[string]Metadata),
+		currents: make(map[string][]currentVersion),
+	}
 }
 
 func (b *MemoryBackend) Get(ctx context.Context, path string, version int) (string, error) {
 	res, err := b.GetMany(ctx, path, version)
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 	if len(res) < 1 {
 		return "", &NotFoundErr{path}
@@ -25,7 +47,7 @@ func (b *MemoryBackend) Get(ctx context.Context, path string, version int) (stri
 func (b *MemoryBackend) GetCurrent(ctx context.Context, path string) (string, error) {
 	res, err := b.GetManyCurrent(ctx, path)
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 	if len(res) < 1 {
 		return "", &NotFoundErr{path}
@@ -33,24 +55,41 @@ func (b *MemoryBackend) GetCurrent(ctx context.Context, path string) (string, er
 	return res[0], nil
 }
 
+// GetManyCurrent returns an empty slice when the path or its current version does not exist, like PostgresBackend
 func (b *MemoryBackend) GetManyCurrent(ctx context.Context, path string) ([]string, error) {
-	metadata, err := b.GetMetadata(ctx, path)
-	if err != nil {
-		return nil, err
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	metadata, ok := b.metadata[path]
+	if !ok {
+		return []string{}, nil
 	}
-	return b.Config[metadata.Path][metadata.CurrentVersion], nil
+	return b.getMany(path, metadata.CurrentVersion), nil
 }
 
+// GetMany returns an empty slice when the path or version does not exist, like PostgresBackend
 func (b *MemoryBackend) GetMany(ctx context.Context, path string, version int) ([]string, error) {
-	pathedConfig, ok := b.Config[path]
-	if !ok {
-		return nil, &NotFoundErr{path}
-	}
-	versionedConfig, ok := pathedConfig[version]
-	if !ok {
-		return nil, &NotFoundErr{path}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.getMany(path, version), nil
+}
+
+func (b *MemoryBackend) GetManyPaths(ctx context.Context, selections []Selection) ([][]string, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	result := make([][]string, len(selections))
+	for i, selection := range selections {
+		version := selection.Version
+		if version == -1 {
+			version = b.metadata[selection.Path].CurrentVersion
+		}
+		result[i] = b.getMany(selection.Path, version)
 	}
-	return versionedConfig, nil
+	return result, nil
+}
+
+// getMany returns a copy of the stored values, so that callers cannot modify the backend, b.mutex must be held
+func (b *MemoryBackend) getMany(path string, version int) []string {
+	return append([]string{}, b.values[path][version]...)
 }
 
 func (b *MemoryBackend) Set(ctx context.Context, path string, value string, options SetOptions) (*Metadata, error) {
@@ -58,33 +97,158 @@ func (b *MemoryBackend) Set(ctx context.Context, path string, value string, opti
 }
 
 func (b *MemoryBackend) SetMany(ctx context.Context, path string, values []string, options SetOptions) (*Metadata, error) {
-	if b.Config[path] == nil {
-		b.Config[path] = make(map[int][]string)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := checkExpectedVersion(path, b.metadata[path].LatestVersion, options); err != nil {
+		return nil, err
 	}
-	var notFoundErr *NotFoundErr
-	metadata, err := b.GetMetadata(ctx, path)
-	if err != nil && errors.As(err, &notFoundErr) {
-		metadata = &Metadata{
+	b.revision++
+	metadata := b.setMany(path, values, options, b.revision)
+	return &metadata, nil
+}
+
+// setMany writes values as a new version of path at revision, b.mutex must be held for writing
+func (b *MemoryBackend) setMany(path string, values []string, options SetOptions, revision int) Metadata {
+	now := time.Now()
+	metadata, ok := b.metadata[path]
+	if !ok {
+		metadata = Metadata{
 			Path:      path,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+			CreatedAt: now,
 		}
-		b.Metadata[path] = *metadata
-	} else if err != nil {
-		return nil, err
+		// the path starts again from the first version, so the versions of a deleted path are forgotten
+		b.values[path] = make(map[int][]string)
+		delete(b.currents, path)
+	}
+	metadata.LatestVersion++
+	if !options.KeepCurrent {
+		metadata.CurrentVersion = metadata.LatestVersion
+		b.currents[path] = append(b.currents[path], currentVersion{Version: metadata.CurrentVersion, At: now, Revision: revision})
 	}
-	b.Config[path][metadata.LatestVersion+1] = values
-	return metadata, nil
+	metadata.UpdatedAt = now
+	metadata.Revision = revision
+	b.values[path][metadata.LatestVersion] = append([]string{}, values...)
+	b.metadata[path] = metadata
+	return metadata
 }
 
 func (b *MemoryBackend) GetMetadata(ctx context.Context, path string) (*Metadata, error) {
-	metadata, ok := b.Metadata[path]
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	metadata, ok := b.metadata[path]
 	if !ok {
 		return nil, &NotFoundErr{path}
 	}
 	return &metadata, nil
 }
 
+func (b *MemoryBackend) GetManyMetadata(ctx context.Context, paths []string) ([]*Metadata, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	result := make([]*Metadata, len(paths))
+	for i, path := range paths {
+		if metadata, ok := b.metadata[path]; ok {
+			result[i] = &metadata
+		}
+	}
+	return result, nil
+}
+
+func (b *MemoryBackend) GetVersionsAt(ctx context.Context, paths []string, at time.Time) ([]int, error) {
+	return b.getVersions(paths, func(current currentVersion) bool {
+		return !current.At.After(at)
+	}), nil
+}
+
+func (b *MemoryBackend) Revision(ctx context.Context) (int, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.revision, nil
+}
+
+func (b *MemoryBackend) GetVersionsAtRevision(ctx context.Context, paths []string, revision int) ([]int, error) {
+	return b.getVersions(paths, func(current currentVersion) bool {
+		return current.Revision <= revision
+	}), nil
+}
+
+// getVersions returns the last version of each path which became current before, as reported by before
+func (b *MemoryBackend) getVersions(paths []string, before func(currentVersion) bool) []int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	result := make([]int, len(paths))
+	for i, path := range paths {
+		currents := b.currents[path]
+		for j := len(currents) - 1; j >= 0; j-- {
+			if before(currents[j]) {
+				result[i] = currents[j].Version
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (b *MemoryBackend) List(ctx context.Context, prefix string) ([]Metadata, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	result := []Metadata{}
+	for path, metadata := range b.metadata {
+		if HasPathPrefix(path, prefix) {
+			result = append(result, metadata)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// Batch holds the write lock for all changes, so no reader observes a partially applied batch
+func (b *MemoryBackend) Batch(ctx context.Context, changes []Change) ([]Metadata, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	// the expected versions are checked against the versions earlier changes leave, before anything is written
+	latest := map[string]int{}
+	for _, change := range changes {
+		version, ok := latest[change.Path]
+		if !ok {
+			version = b.metadata[change.Path].LatestVersion
+		}
+		if change.Delete {
+			latest[change.Path] = 0
+			continue
+		}
+		if err := checkExpectedVersion(change.Path, version, change.Options); err != nil {
+			return nil, err
+		}
+		latest[change.Path] = version + 1
+	}
+
+	if len(changes) > 0 {
+		b.revision++
+	}
+	result := []Metadata{}
+	for _, change := range changes {
+		if change.Delete {
+			b.delete(change.Path, b.revision)
+			continue
+		}
+		result = append(result, b.setMany(change.Path, change.Values, change.Options, b.revision))
+	}
+	return result, nil
+}
+
+// delete removes the metadata of path and records the delete as version 0 becoming current at revision.
+// The versions are kept for the reads before the delete, until the path is written again. b.mutex must be held for writing.
+func (b *MemoryBackend) delete(path string, revision int) {
+	if _, ok := b.metadata[path]; !ok {
+		return
+	}
+	delete(b.metadata, path)
+	b.currents[path] = append(b.currents[path], currentVersion{Version: 0, At: time.Now(), Revision: revision})
+}
+
 func (b *MemoryBackend) Close(ctx context.Context) error {
 	return nil
 }
@@ -0,0 +1,16 @@
+package backend_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/backend/backendtest"
+)
+
+var _ = Describe("Memory", func() {
+	backendtest.Conformance(func(ctx context.Context) backend.Backend {
+		return backend.NewMemoryBackend()
+	})
+})
@@ -2,7 +2,10 @@ package backend
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	pgxzap "github.com/jackc/pgx-zap"
 	"github.com/jackc/pgx/v5"
@@ -104,16 +107,47 @@ func (b *PostgresBackend) GetMany(ctx context.Context, path string, version int)
 	return result, nil
 }
 
+func (b *PostgresBackend) GetManyPaths(ctx context.Context, selections []Selection) ([][]string, error) {
+	paths := make([]string, len(selections))
+	versions := make([]int32, len(selections))
+	for i, selection := range selections {
+		paths[i], versions[i] = selection.Path, int32(selection.Version)
+	}
+	rows, err := b.Conn.Query(
+		ctx,
+		`SELECT s.i, config.value FROM unnest($1::varchar[], $2::int[]) WITH ORDINALITY AS s(path, version, i)
+		LEFT JOIN config_metadata ON config_metadata.path = s.path
+		INNER JOIN config ON config.path = s.path
+			AND config.version = CASE WHEN s.version = -1 THEN config_metadata.current_version ELSE s.version END
+		ORDER BY s.i, config.id`,
+		paths,
+		versions,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rows: %w", err)
+	}
+	defer rows.Close()
+	result := make([][]string, len(selections))
+	for i := range result {
+		result[i] = []string{}
+	}
+	for rows.Next() {
+		var i int
+		var value string
+		if err := rows.Scan(&i, &value); err != nil {
+			return nil, err
+		}
+		// ordinality starts from 1
+		result[i-1] = append(result[i-1], value)
+	}
+	return result, rows.Err()
+}
+
 func (b *PostgresBackend) Set(ctx context.Context, path, value string, options SetOptions) (*Metadata, error) {
 	return b.SetMany(ctx, path, []string{value}, options)
 }
 
 func (b *PostgresBackend) SetMany(ctx context.Context, path string, values []string, options SetOptions) (*Metadata, error) {
-	_, err := b.Conn.Exec(ctx, `INSERT INTO config_metadata (path) VALUES ($1) ON CONFLICT (path) DO NOTHING`, path)
-	if err != nil {
-		return nil, err
-	}
-
 	// the statements are wrapped inside a transaction to ensure the data insertion and metadata update is atomic
 	// it also holds other connection from modifying the metadata entry
 	tx, err := b.Conn.Begin(ctx)
@@ -122,19 +156,79 @@ func (b *PostgresBackend) SetMany(ctx context.Context, path string, values []str
 	}
 	defer tx.Rollback(ctx)
 
+	// the revision is taken first like in Batch, so that both lock the rows in the same order
+	revision, err := postgresNextRevision(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the entry is created inside the transaction, so that it is not left behind when the write fails
+	if err := postgresCreateMetadata(ctx, tx, path); err != nil {
+		return nil, err
+	}
+	metadata, err := b.setMany(ctx, tx, path, values, options, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+// postgresNextRevision increments the global revision inside tx, returning the new revision.
+// The counter row stays locked until tx ends, so the revisions are committed in order.
+func postgresNextRevision(ctx context.Context, tx pgx.Tx) (int, error) {
+	var revision int
+	row := tx.QueryRow(
+		ctx,
+		`INSERT INTO config_revision (id, revision) VALUES (1, 1)
+		ON CONFLICT (id) DO UPDATE SET revision = config_revision.revision + 1 RETURNING revision`,
+	)
+	if err := row.Scan(&revision); err != nil {
+		return 0, fmt.Errorf("failed to increment the revision: %w", err)
+	}
+	return revision, nil
+}
+
+// postgresCreateMetadata creates the metadata entry of path inside tx when it does not exist.
+// The path then starts again from the first version, so the versions of a deleted path are forgotten.
+func postgresCreateMetadata(ctx context.Context, tx pgx.Tx, path string) error {
+	created, err := tx.Exec(ctx, `INSERT INTO config_metadata (path) VALUES ($1) ON CONFLICT (path) DO NOTHING`, path)
+	if err != nil || created.RowsAffected() == 0 {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM config WHERE path = $1`, path); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM config_current_versions WHERE path = $1`, path)
+	return err
+}
+
+// setMany writes values as a new version of path at revision inside tx, the metadata entry of path must already exist
+func (b *PostgresBackend) setMany(ctx context.Context, tx pgx.Tx, path string, values []string, options SetOptions, revision int) (*Metadata, error) {
 	var metadata Metadata
-	row := tx.QueryRow(ctx, `UPDATE config_metadata SET latest_version = latest_version + 1, updated_at = NOW() WHERE path = $1 RETURNING (path, latest_version, current_version, created_at, updated_at)`, path)
+	row := tx.QueryRow(ctx, `UPDATE config_metadata SET latest_version = latest_version + 1, updated_at = NOW(), revision = $2 WHERE path = $1 RETURNING (path, latest_version, current_version, created_at, updated_at, revision)`, path, revision)
 	if err := row.Scan(&metadata); err != nil {
 		return nil, err
 	}
+	// the transaction is rolled back on conflicts, undoing the update
+	if err := checkExpectedVersion(path, metadata.LatestVersion-1, options); err != nil {
+		return nil, err
+	}
 
 	if !options.KeepCurrent {
 		row := tx.QueryRow(ctx, `UPDATE config_metadata SET current_version = latest_version WHERE path = $1 RETURNING (current_version)`, path)
 		if err := row.Scan(&metadata.CurrentVersion); err != nil {
 			return nil, err
 		}
+		if _, err := tx.Exec(ctx, `INSERT INTO config_current_versions (path, version, revision) VALUES ($1, $2, $3)`, path, metadata.CurrentVersion, revision); err != nil {
+			return nil, err
+		}
 	}
-	_, err = tx.CopyFrom(
+	_, err := tx.CopyFrom(
 		ctx,
 		pgx.Identifier{"config"},
 		[]string{"path", "version", "value"},
@@ -145,12 +239,129 @@ func (b *PostgresBackend) SetMany(ctx context.Context, path string, values []str
 	if err != nil {
 		return nil, err
 	}
+	return &metadata, nil
+}
+
+func (b *PostgresBackend) GetVersionsAt(ctx context.Context, paths []string, at time.Time) ([]int, error) {
+	// current_at holds NOW() in the time zone of the session, which is also how the timestamptz parameter is compared with it
+	return b.getVersions(ctx, paths, `current_at <= $2::timestamptz`, `current_at DESC`, at)
+}
+
+func (b *PostgresBackend) Revision(ctx context.Context) (int, error) {
+	var revision int
+	row := b.Conn.QueryRow(ctx, `SELECT COALESCE(MAX(revision), 0) FROM config_revision`)
+	if err := row.Scan(&revision); err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+func (b *PostgresBackend) GetVersionsAtRevision(ctx context.Context, paths []string, revision int) ([]int, error) {
+	return b.getVersions(ctx, paths, `revision <= $2`, `revision DESC`, revision)
+}
+
+// getVersions returns the first version of each path in config_current_versions matching where, in the given order
+func (b *PostgresBackend) getVersions(ctx context.Context, paths []string, where, order string, arg any) ([]int, error) {
+	rows, err := b.Conn.Query(
+		ctx,
+		`SELECT DISTINCT ON (p.i) p.i, config_current_versions.version FROM unnest($1::varchar[]) WITH ORDINALITY AS p(path, i)
+		INNER JOIN config_current_versions ON config_current_versions.path = p.path AND config_current_versions.`+where+`
+		ORDER BY p.i, config_current_versions.`+order+`, config_current_versions.id DESC`,
+		paths,
+		arg,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rows: %w", err)
+	}
+	defer rows.Close()
+	result := make([]int, len(paths))
+	for rows.Next() {
+		var i, version int
+		if err := rows.Scan(&i, &version); err != nil {
+			return nil, err
+		}
+		// ordinality starts from 1
+		result[i-1] = version
+	}
+	return result, rows.Err()
+}
+
+func (b *PostgresBackend) List(ctx context.Context, prefix string) ([]Metadata, error) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	// escape the LIKE wildcards so that only the literal prefix is matched
+	pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "/%"
+	rows, err := b.Conn.Query(
+		ctx,
+		`SELECT path, latest_version, current_version, created_at, updated_at, revision FROM config_metadata
+		WHERE path = $1 OR path LIKE $2
+		ORDER BY path`,
+		prefix,
+		pattern,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rows: %w", err)
+	}
+	defer rows.Close()
+	result := []Metadata{}
+	for rows.Next() {
+		var metadata Metadata
+		err = rows.Scan(&metadata.Path, &metadata.LatestVersion, &metadata.CurrentVersion, &metadata.CreatedAt, &metadata.UpdatedAt, &metadata.Revision)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, metadata)
+	}
+	return result, rows.Err()
+}
+
+func (b *PostgresBackend) Batch(ctx context.Context, changes []Change) ([]Metadata, error) {
+	// all changes share a single transaction, so either every change is visible or none of them are
+	tx, err := b.Conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	result := []Metadata{}
+	if len(changes) == 0 {
+		return result, nil
+	}
+	revision, err := postgresNextRevision(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if change.Delete {
+			if err := b.delete(ctx, tx, change.Path, revision); err != nil {
+				return nil, fmt.Errorf("failed to delete %s: %w", change.Path, err)
+			}
+			continue
+		}
+		if err := postgresCreateMetadata(ctx, tx, change.Path); err != nil {
+			return nil, err
+		}
+		metadata, err := b.setMany(ctx, tx, change.Path, change.Values, change.Options, revision)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", change.Path, err)
+		}
+		result = append(result, *metadata)
+	}
 
 	if err := tx.Commit(ctx); err != nil {
 		return nil, err
 	}
+	return result, nil
+}
 
-	return &metadata, nil
+// delete removes the metadata entry of path inside tx and records the delete as version 0 becoming current at revision.
+// The versions are kept for the reads before the delete, until the path is written again.
+func (b *PostgresBackend) delete(ctx context.Context, tx pgx.Tx, path string, revision int) error {
+	deleted, err := tx.Exec(ctx, `DELETE FROM config_metadata WHERE path = $1`, path)
+	if err != nil || deleted.RowsAffected() == 0 {
+		return err
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO config_current_versions (path, version, revision) VALUES ($1, 0, $2)`, path, revision)
+	return err
 }
 
 func (b *PostgresBackend) Delete(ctx context.Context, path string, version int) error {
@@ -164,13 +375,41 @@ func (b *PostgresBackend) Delete(ctx context.Context, path string, version int)
 
 func (b *PostgresBackend) GetMetadata(ctx context.Context, path string) (*Metadata, error) {
 	var metadata Metadata
-	row := b.Conn.QueryRow(ctx, `SELECT path, latest_version, current_version, created_at, updated_at FROM config_metadata WHERE path = $1`, path)
-	if err := row.Scan(&metadata.Path, &metadata.LatestVersion, &metadata.CurrentVersion, &metadata.CreatedAt, &metadata.CreatedAt); err != nil {
+	row := b.Conn.QueryRow(ctx, `SELECT path, latest_version, current_version, created_at, updated_at, revision FROM config_metadata WHERE path = $1`, path)
+	if err := row.Scan(&metadata.Path, &metadata.LatestVersion, &metadata.CurrentVersion, &metadata.CreatedAt, &metadata.UpdatedAt, &metadata.Revision); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &NotFoundErr{Path: path}
+		}
 		return nil, err
 	}
 	return &metadata, nil
 }
 
+func (b *PostgresBackend) GetManyMetadata(ctx context.Context, paths []string) ([]*Metadata, error) {
+	rows, err := b.Conn.Query(
+		ctx,
+		`SELECT p.i, m.path, m.latest_version, m.current_version, m.created_at, m.updated_at, m.revision
+		FROM unnest($1::varchar[]) WITH ORDINALITY AS p(path, i)
+		INNER JOIN config_metadata m ON m.path = p.path`,
+		paths,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rows: %w", err)
+	}
+	defer rows.Close()
+	result := make([]*Metadata, len(paths))
+	for rows.Next() {
+		var i int
+		var metadata Metadata
+		if err := rows.Scan(&i, &metadata.Path, &metadata.LatestVersion, &metadata.CurrentVersion, &metadata.CreatedAt, &metadata.UpdatedAt, &metadata.Revision); err != nil {
+			return nil, err
+		}
+		// ordinality starts from 1
+		result[i-1] = &metadata
+	}
+	return result, rows.Err()
+}
+
 func (b *PostgresBackend) Close(context.Context) error {
 	b.Conn.Close()
 	return nil
@@ -11,6 +11,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/backend/backendtest"
 )
 
 //go:embed schema/config.sql
@@ -35,6 +36,12 @@ var _ = Describe("Postgres", func() {
 		Expect(err).ShouldNot(HaveOccurred())
 	})
 
+	Describe("conformance", func() {
+		backendtest.Conformance(func(ctx context.Context) backend.Backend {
+			return pgBackend
+		})
+	})
+
 	Describe("Get", func() {
 		When("there is no metadata of the path exists", func() {
 			It("should return not found error", func(ctx context.Context) {
@@ -0,0 +1,449 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type RedisConfig struct {
+	Address  string `mapstructure:"address" validate:"required"`
+	UserName string `mapstructure:"user_name"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	// Prefix is prepended to every key, "dendrite:" when empty
+	Prefix string `mapstructure:"prefix"`
+}
+
+// RedisBackend stores the config in Redis under these keys:
+//
+//	<prefix>meta:<path>               hash of latest_version, current_version, created_at, updated_at and revision
+//	<prefix>values:<path>:<version>   list of the values of a version
+//	<prefix>paths                     sorted set of every path, for listing by prefix
+//	<prefix>current:<path>            sorted set of the versions which became current and of the delete, scored by the unix time in microseconds
+//	<prefix>revisions:<path>          sorted set of the versions which became current and of the delete, scored by the revision
+//	<prefix>deleted:<path>            the latest version of a deleted path, whose versions are kept until it is written again
+//	<prefix>revision                  the global revision
+//
+// Writes run as a single Lua script, so versions are bumped atomically and no reader observes a partial batch.
+// The script builds the keys it touches from the path, so it cannot run on Redis Cluster.
+type RedisBackend struct {
+	Client *redis.Client
+	prefix string
+}
+
+// redisBatchScript applies a JSON array of changes and returns the metadata fields of every change which is not a deletion.
+// When a change expects another latest version, nothing is written and the script fails with "CONFLICT <index> <latest version>".
+var redisBatchScript = redis.NewScript(`
+local prefix = ARGV[1]
+local now = ARGV[2]
+local changes = cjson.decode(ARGV[3])
+local nowMicro = ARGV[4]
+local latest = {}
+for i, change in ipairs(changes) do
+	local version = latest[change.path]
+	if version == nil then
+		version = tonumber(redis.call('HGET', prefix .. 'meta:' .. change.path, 'latest_version') or 0)
+	end
+	if change.delete then
+		latest[change.path] = 0
+	else
+		if change.expectedVersion ~= nil and change.expectedVersion ~= version then
+			return redis.error_reply('CONFLICT ' .. (i - 1) .. ' ' .. version)
+		end
+		latest[change.path] = version + 1
+	end
+end
+local result = {}
+if #changes == 0 then
+	return result
+end
+local revision = redis.call('INCR', prefix .. 'revision')
+for _, change in ipairs(changes) do
+	local meta = prefix .. 'meta:' .. change.path
+	if change.delete then
+		-- the versions are kept for the reads before the delete, which is recorded as a member following every version
+		local latest = redis.call('HGET', meta, 'latest_version')
+		if latest then
+			redis.call('DEL', meta)
+			redis.call('ZREM', prefix .. 'paths', change.path)
+			redis.call('SET', prefix .. 'deleted:' .. change.path, latest)
+			redis.call('ZADD', prefix .. 'current:' .. change.path, nowMicro, 'deleted')
+			redis.call('ZADD', prefix .. 'revisions:' .. change.path, revision, 'deleted')
+		end
+	else
+		local latest = redis.call('HINCRBY', meta, 'latest_version', 1)
+		if latest == 1 then
+			-- the path starts again from the first version, so the versions of a deleted path are forgotten
+			local deleted = tonumber(redis.call('GET', prefix .. 'deleted:' .. change.path) or 0)
+			for version = 1, deleted do
+				redis.call('DEL', prefix .. 'values:' .. change.path .. ':' .. version)
+			end
+			redis.call('DEL', prefix .. 'deleted:' .. change.path, prefix .. 'current:' .. change.path, prefix .. 'revisions:' .. change.path)
+			redis.call('HSET', meta, 'current_version', 0, 'created_at', now)
+		end
+		if not change.keepCurrent then
+			redis.call('HSET', meta, 'current_version', latest)
+			-- versions are padded, so that versions which became current within the same microsecond are ordered by version
+			redis.call('ZADD', prefix .. 'current:' .. change.path, nowMicro, string.format('%010d', latest))
+			redis.call('ZADD', prefix .. 'revisions:' .. change.path, revision, string.format('%010d', latest))
+		end
+		redis.call('HSET', meta, 'updated_at', now, 'revision', revision)
+		local key = prefix .. 'values:' .. change.path .. ':' .. latest
+		for _, value in ipairs(change.values) do
+			redis.call('RPUSH', key, value)
+		end
+		redis.call('ZADD', prefix .. 'paths', 0, change.path)
+		table.insert(result, redis.call('HMGET', meta, 'latest_version', 'current_version', 'created_at', 'updated_at', 'revision'))
+	end
+end
+return result
+`)
+
+// redisDeletedMember records the delete of a path in its sorted sets of current versions,
+// it follows the padded versions so that it wins over a version which became current with the same score
+const redisDeletedMember = "deleted"
+
+type redisChange struct {
+	Path        string   `json:"path"`
+	Values      []string `json:"values"`
+	Delete      bool     `json:"delete"`
+	KeepCurrent bool     `json:"keepCurrent"`
+	// ExpectedVersion is omitted rather than null when it is not set, as cjson decodes null to a value which is not nil
+	ExpectedVersion *int `json:"expectedVersion,omitempty"`
+}
+
+var redisMetadataFields = []string{"latest_version", "current_version", "created_at", "updated_at", "revision"}
+
+func NewRedisBackend(config RedisConfig) (Backend, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     config.Address,
+		Username: config.UserName,
+		Password: config.Password,
+		DB:       config.DB,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to %s: %w", config.Address, err)
+	}
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = "dendrite:"
+	}
+	return &RedisBackend{Client: client, prefix: prefix}, nil
+}
+
+func (b *RedisBackend) metadataKey(path string) string {
+	return b.prefix + "meta:" + path
+}
+
+func (b *RedisBackend) valuesKey(path string, version int) string {
+	return b.prefix + "values:" + path + ":" + strconv.Itoa(version)
+}
+
+// parseRedisMetadata parses the metadata fields in the order of redisMetadataFields
+func parseRedisMetadata(path string, fields []any) (*Metadata, error) {
+	if len(fields) != len(redisMetadataFields) || fields[0] == nil {
+		return nil, &NotFoundErr{Path: path}
+	}
+	metadata := Metadata{Path: path}
+	var err error
+	text := make([]string, len(fields))
+	for i, field := range fields {
+		switch field := field.(type) {
+		case string:
+			text[i] = field
+		case int64:
+			text[i] = strconv.FormatInt(field, 10)
+		case nil:
+			// written before the field was added
+			text[i] = "0"
+		default:
+			return nil, fmt.Errorf("corrupted metadata of %s: unexpected %s %v", path, redisMetadataFields[i], field)
+		}
+	}
+	if metadata.LatestVersion, err = strconv.Atoi(text[0]); err != nil {
+		return nil, fmt.Errorf("corrupted metadata of %s: %w", path, err)
+	}
+	if metadata.CurrentVersion, err = strconv.Atoi(text[1]); err != nil {
+		return nil, fmt.Errorf("corrupted metadata of %s: %w", path, err)
+	}
+	if metadata.CreatedAt, err = time.Parse(time.RFC3339Nano, text[2]); err != nil {
+		return nil, fmt.Errorf("corrupted metadata of %s: %w", path, err)
+	}
+	if metadata.UpdatedAt, err = time.Parse(time.RFC3339Nano, text[3]); err != nil {
+		return nil, fmt.Errorf("corrupted metadata of %s: %w", path, err)
+	}
+	if metadata.Revision, err = strconv.Atoi(text[4]); err != nil {
+		return nil, fmt.Errorf("corrupted metadata of %s: %w", path, err)
+	}
+	return &metadata, nil
+}
+
+func (b *RedisBackend) GetCurrent(ctx context.Context, path string) (string, error) {
+	result, err := b.GetManyCurrent(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if len(result) < 1 {
+		return "", &NotFoundErr{Path: path}
+	}
+	return result[0], nil
+}
+
+func (b *RedisBackend) Get(ctx context.Context, path string, version int) (string, error) {
+	result, err := b.GetMany(ctx, path, version)
+	if err != nil {
+		return "", err
+	}
+	if len(result) < 1 {
+		return "", &NotFoundErr{Path: path}
+	}
+	return result[0], nil
+}
+
+func (b *RedisBackend) GetManyCurrent(ctx context.Context, path string) ([]string, error) {
+	version, err := b.Client.HGet(ctx, b.metadataKey(path), "current_version").Int()
+	if errors.Is(err, redis.Nil) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return b.GetMany(ctx, path, version)
+}
+
+func (b *RedisBackend) GetMany(ctx context.Context, path string, version int) ([]string, error) {
+	return b.Client.LRange(ctx, b.valuesKey(path, version), 0, -1).Result()
+}
+
+// GetManyPaths reads the current versions of the selections in one pipeline, and the values in another one
+func (b *RedisBackend) GetManyPaths(ctx context.Context, selections []Selection) ([][]string, error) {
+	versions := make([]int, len(selections))
+	current := map[int]*redis.StringCmd{}
+	pipe := b.Client.Pipeline()
+	for i, selection := range selections {
+		versions[i] = selection.Version
+		if selection.Version == -1 {
+			current[i] = pipe.HGet(ctx, b.metadataKey(selection.Path), "current_version")
+		}
+	}
+	if len(current) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+	}
+	for i, command := range current {
+		version, err := command.Int()
+		if errors.Is(err, redis.Nil) {
+			version = 0
+		} else if err != nil {
+			return nil, err
+		}
+		versions[i] = version
+	}
+
+	commands := make([]*redis.StringSliceCmd, len(selections))
+	for i, selection := range selections {
+		commands[i] = pipe.LRange(ctx, b.valuesKey(selection.Path, versions[i]), 0, -1)
+	}
+	if len(commands) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+	result := make([][]string, len(selections))
+	for i, command := range commands {
+		result[i] = command.Val()
+	}
+	return result, nil
+}
+
+func (b *RedisBackend) Set(ctx context.Context, path, value string, options SetOptions) (*Metadata, error) {
+	return b.SetMany(ctx, path, []string{value}, options)
+}
+
+func (b *RedisBackend) SetMany(ctx context.Context, path string, values []string, options SetOptions) (*Metadata, error) {
+	result, err := b.Batch(ctx, []Change{{Path: path, Values: values, Options: options}})
+	if err != nil {
+		return nil, err
+	}
+	return &result[0], nil
+}
+
+func (b *RedisBackend) GetMetadata(ctx context.Context, path string) (*Metadata, error) {
+	fields, err := b.Client.HMGet(ctx, b.metadataKey(path), redisMetadataFields...).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseRedisMetadata(path, fields)
+}
+
+// GetManyMetadata reads the metadata of every path in one pipeline
+func (b *RedisBackend) GetManyMetadata(ctx context.Context, paths []string) ([]*Metadata, error) {
+	result := make([]*Metadata, len(paths))
+	if len(paths) == 0 {
+		return result, nil
+	}
+	pipe := b.Client.Pipeline()
+	commands := make([]*redis.SliceCmd, len(paths))
+	for i, path := range paths {
+		commands[i] = pipe.HMGet(ctx, b.metadataKey(path), redisMetadataFields...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	for i, command := range commands {
+		metadata, err := parseRedisMetadata(paths[i], command.Val())
+		var notFoundErr *NotFoundErr
+		if errors.As(err, &notFoundErr) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		result[i] = metadata
+	}
+	return result, nil
+}
+
+func (b *RedisBackend) GetVersionsAt(ctx context.Context, paths []string, at time.Time) ([]int, error) {
+	return b.getVersions(ctx, paths, "current:", strconv.FormatInt(at.UnixMicro(), 10))
+}
+
+func (b *RedisBackend) Revision(ctx context.Context) (int, error) {
+	revision, err := b.Client.Get(ctx, b.prefix+"revision").Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return revision, err
+}
+
+func (b *RedisBackend) GetVersionsAtRevision(ctx context.Context, paths []string, revision int) ([]int, error) {
+	return b.getVersions(ctx, paths, "revisions:", strconv.Itoa(revision))
+}
+
+// getVersions returns the version of each path with the highest score up to max in the sorted sets named by kind
+func (b *RedisBackend) getVersions(ctx context.Context, paths []string, kind string, max string) ([]int, error) {
+	pipe := b.Client.Pipeline()
+	commands := make([]*redis.StringSliceCmd, len(paths))
+	for i, path := range paths {
+		commands[i] = pipe.ZRevRangeByScore(ctx, b.prefix+kind+path, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   max,
+			Count: 1,
+		})
+	}
+	if len(commands) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+	result := make([]int, len(paths))
+	for i, command := range commands {
+		if members := command.Val(); len(members) > 0 && members[0] != redisDeletedMember {
+			version, err := strconv.Atoi(members[0])
+			if err != nil {
+				return nil, fmt.Errorf("corrupted current versions of %s: %w", paths[i], err)
+			}
+			result[i] = version
+		}
+	}
+	return result, nil
+}
+
+func (b *RedisBackend) List(ctx context.Context, prefix string) ([]Metadata, error) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	// "0" follows "/", so the range covers the prefix and every path below it, along with some siblings filtered below
+	paths, err := b.Client.ZRangeByLex(ctx, b.prefix+"paths", &redis.ZRangeBy{Min: "[" + prefix, Max: "(" + prefix + "0"}).Result()
+	if err != nil {
+		return nil, err
+	}
+	pipe := b.Client.Pipeline()
+	commands := make([]*redis.SliceCmd, 0, len(paths))
+	for _, path := range paths {
+		if HasPathPrefix(path, prefix) {
+			commands = append(commands, pipe.HMGet(ctx, b.metadataKey(path), redisMetadataFields...))
+		}
+	}
+	if len(commands) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+	result := []Metadata{}
+	for _, command := range commands {
+		path := strings.TrimPrefix(command.Args()[1].(string), b.prefix+"meta:")
+		metadata, err := parseRedisMetadata(path, command.Val())
+		var notFoundErr *NotFoundErr
+		if errors.As(err, &notFoundErr) {
+			// deleted after the paths were listed
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		result = append(result, *metadata)
+	}
+	return result, nil
+}
+
+func (b *RedisBackend) Batch(ctx context.Context, changes []Change) ([]Metadata, error) {
+	input := make([]redisChange, 0, len(changes))
+	for _, change := range changes {
+		values := change.Values
+		if values == nil {
+			values = []string{}
+		}
+		input = append(input, redisChange{
+			Path:            change.Path,
+			Values:          values,
+			Delete:          change.Delete,
+			KeepCurrent:     change.Options.KeepCurrent,
+			ExpectedVersion: change.Options.ExpectedVersion,
+		})
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	output, err := redisBatchScript.Run(ctx, b.Client, nil, b.prefix, now.Format(time.RFC3339Nano), string(data), now.UnixMicro()).Slice()
+	var i, latest int
+	// some servers report the error of the script with an ERR prefix
+	if message := strings.TrimPrefix(fmt.Sprint(err), "ERR "); err != nil && strings.HasPrefix(message, "CONFLICT ") {
+		if _, scanErr := fmt.Sscanf(message, "CONFLICT %d %d", &i, &latest); scanErr == nil && i < len(changes) {
+			return nil, &ConflictErr{Path: changes[i].Path, ExpectedVersion: *changes[i].Options.ExpectedVersion, LatestVersion: latest}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Metadata{}
+	for _, change := range changes {
+		if change.Delete {
+			continue
+		}
+		var fields []any
+		if len(result) < len(output) {
+			fields, _ = output[len(result)].([]any)
+		}
+		if fields == nil {
+			return nil, fmt.Errorf("unexpected result of the script for %s", change.Path)
+		}
+		metadata, err := parseRedisMetadata(change.Path, fields)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *metadata)
+	}
+	return result, nil
+}
+
+func (b *RedisBackend) Close(context.Context) error {
+	return b.Client.Close()
+}
@@ -0,0 +1,43 @@
+package backend_test
+
+import (
+	"context"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/backend/backendtest"
+)
+
+var _ = Describe("Redis", func() {
+	newRedisBackend := func() (*miniredis.Miniredis, backend.Backend) {
+		server := miniredis.NewMiniRedis()
+		Expect(server.Start()).To(Succeed())
+		DeferCleanup(server.Close)
+		redisBackend, err := backend.NewRedisBackend(backend.RedisConfig{Address: server.Addr()})
+		Expect(err).NotTo(HaveOccurred())
+		return server, redisBackend
+	}
+
+	backendtest.Conformance(func(ctx context.Context) backend.Backend {
+		_, redisBackend := newRedisBackend()
+		return redisBackend
+	})
+
+	It("should keep the versions of a deleted path until it is written again", func(ctx context.Context) {
+		server, redisBackend := newRedisBackend()
+		defer redisBackend.Close(ctx)
+		Expect(redisBackend.Set(ctx, "/a/b", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+		Expect(redisBackend.Set(ctx, "/a/b", "2", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+		Expect(server.Keys()).To(ConsistOf("dendrite:meta:/a/b", "dendrite:values:/a/b:1", "dendrite:values:/a/b:2", "dendrite:current:/a/b", "dendrite:revisions:/a/b", "dendrite:revision", "dendrite:paths"))
+
+		Expect(redisBackend.Batch(ctx, []backend.Change{{Path: "/a/b", Delete: true}})).To(BeEmpty())
+		Expect(server.Keys()).To(ConsistOf("dendrite:values:/a/b:1", "dendrite:values:/a/b:2", "dendrite:current:/a/b", "dendrite:revisions:/a/b", "dendrite:deleted:/a/b", "dendrite:revision"))
+
+		Expect(redisBackend.Set(ctx, "/a/b", "3", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+		Expect(server.Keys()).To(ConsistOf("dendrite:meta:/a/b", "dendrite:values:/a/b:1", "dendrite:current:/a/b", "dendrite:revisions:/a/b", "dendrite:revision", "dendrite:paths"))
+		Expect(server.ZMembers("dendrite:revisions:/a/b")).To(Equal([]string{"0000000001"}))
+	})
+})
@@ -0,0 +1,279 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type MountConfig struct {
+	// Prefix is the path under which Backend stores the config, e.g. /secrets
+	Prefix  string  `mapstructure:"prefix" validate:"required,startswith=/"`
+	Backend *Config `mapstructure:"backend" validate:"required"`
+}
+
+// Mount is a child backend of a RouterBackend, storing prefix and every path below it
+type Mount struct {
+	Prefix  string
+	Backend Backend
+}
+
+// RouterBackend dispatches every path to the mount with the longest matching prefix.
+// Children store the full paths, so a child can later be mounted at the root without migrating its data.
+//
+// A Batch must write the paths of a single mount, as the mounts cannot apply changes atomically together.
+// Revisions are supported only with a single mount, as every mount counts its own revisions.
+type RouterBackend struct {
+	// mounts are ordered from the longest prefix to the shortest
+	mounts []Mount
+}
+
+func NewRouterBackend(mounts []Mount) (*RouterBackend, error) {
+	result := make([]Mount, 0, len(mounts))
+	seen := map[string]bool{}
+	for _, mount := range mounts {
+		prefix := strings.TrimSuffix(mount.Prefix, "/")
+		if seen[prefix] {
+			return nil, fmt.Errorf("prefix %s is mounted more than once", mount.Prefix)
+		}
+		seen[prefix] = true
+		result = append(result, Mount{Prefix: prefix, Backend: mount.Backend})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return len(result[i].Prefix) > len(result[j].Prefix)
+	})
+	return &RouterBackend{mounts: result}, nil
+}
+
+// route returns the index of the mount of path
+func (b *RouterBackend) route(path string) (int, error) {
+	for i, mount := range b.mounts {
+		if HasPathPrefix(path, mount.Prefix) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("no backend is mounted for path %s", path)
+}
+
+func (b *RouterBackend) backend(path string) (Backend, error) {
+	i, err := b.route(path)
+	if err != nil {
+		return nil, err
+	}
+	return b.mounts[i].Backend, nil
+}
+
+func (b *RouterBackend) GetCurrent(ctx context.Context, path string) (string, error) {
+	backend, err := b.backend(path)
+	if err != nil {
+		return "", err
+	}
+	return backend.GetCurrent(ctx, path)
+}
+
+func (b *RouterBackend) Get(ctx context.Context, path string, version int) (string, error) {
+	backend, err := b.backend(path)
+	if err != nil {
+		return "", err
+	}
+	return backend.Get(ctx, path, version)
+}
+
+func (b *RouterBackend) GetManyCurrent(ctx context.Context, path string) ([]string, error) {
+	backend, err := b.backend(path)
+	if err != nil {
+		return nil, err
+	}
+	return backend.GetManyCurrent(ctx, path)
+}
+
+func (b *RouterBackend) GetMany(ctx context.Context, path string, version int) ([]string, error) {
+	backend, err := b.backend(path)
+	if err != nil {
+		return nil, err
+	}
+	return backend.GetMany(ctx, path, version)
+}
+
+// GetManyPaths sends the selections of each mount to it at once
+func (b *RouterBackend) GetManyPaths(ctx context.Context, selections []Selection) ([][]string, error) {
+	groups := map[int][]Selection{}
+	positions := map[int][]int{}
+	for position, selection := range selections {
+		i, err := b.route(selection.Path)
+		if err != nil {
+			return nil, err
+		}
+		groups[i] = append(groups[i], selection)
+		positions[i] = append(positions[i], position)
+	}
+	result := make([][]string, len(selections))
+	for i, group := range groups {
+		values, err := b.mounts[i].Backend.GetManyPaths(ctx, group)
+		if err != nil {
+			return nil, err
+		}
+		for j, position := range positions[i] {
+			result[position] = values[j]
+		}
+	}
+	return result, nil
+}
+
+// GetManyMetadata sends the paths of each mount to it at once
+func (b *RouterBackend) GetManyMetadata(ctx context.Context, paths []string) ([]*Metadata, error) {
+	groups := map[int][]string{}
+	positions := map[int][]int{}
+	for position, path := range paths {
+		i, err := b.route(path)
+		if err != nil {
+			return nil, err
+		}
+		groups[i] = append(groups[i], path)
+		positions[i] = append(positions[i], position)
+	}
+	result := make([]*Metadata, len(paths))
+	for i, group := range groups {
+		metadata, err := b.mounts[i].Backend.GetManyMetadata(ctx, group)
+		if err != nil {
+			return nil, err
+		}
+		for j, position := range positions[i] {
+			result[position] = metadata[j]
+		}
+	}
+	return result, nil
+}
+
+// GetVersionsAt sends the paths of each mount to it at once
+func (b *RouterBackend) GetVersionsAt(ctx context.Context, paths []string, at time.Time) ([]int, error) {
+	groups := map[int][]string{}
+	positions := map[int][]int{}
+	for position, path := range paths {
+		i, err := b.route(path)
+		if err != nil {
+			return nil, err
+		}
+		groups[i] = append(groups[i], path)
+		positions[i] = append(positions[i], position)
+	}
+	result := make([]int, len(paths))
+	for i, group := range groups {
+		versions, err := b.mounts[i].Backend.GetVersionsAt(ctx, group, at)
+		if err != nil {
+			return nil, err
+		}
+		for j, position := range positions[i] {
+			result[position] = versions[j]
+		}
+	}
+	return result, nil
+}
+
+// Revision returns the revision of the only mount, revisions are not supported across mounts
+func (b *RouterBackend) Revision(ctx context.Context) (int, error) {
+	if len(b.mounts) != 1 {
+		return 0, ErrRevisionsUnsupported
+	}
+	return b.mounts[0].Backend.Revision(ctx)
+}
+
+func (b *RouterBackend) GetVersionsAtRevision(ctx context.Context, paths []string, revision int) ([]int, error) {
+	if len(b.mounts) != 1 {
+		return nil, ErrRevisionsUnsupported
+	}
+	for _, path := range paths {
+		if _, err := b.route(path); err != nil {
+			return nil, err
+		}
+	}
+	return b.mounts[0].Backend.GetVersionsAtRevision(ctx, paths, revision)
+}
+
+func (b *RouterBackend) Set(ctx context.Context, path string, value string, options SetOptions) (*Metadata, error) {
+	backend, err := b.backend(path)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Set(ctx, path, value, options)
+}
+
+func (b *RouterBackend) SetMany(ctx context.Context, path string, values []string, options SetOptions) (*Metadata, error) {
+	backend, err := b.backend(path)
+	if err != nil {
+		return nil, err
+	}
+	return backend.SetMany(ctx, path, values, options)
+}
+
+func (b *RouterBackend) GetMetadata(ctx context.Context, path string) (*Metadata, error) {
+	backend, err := b.backend(path)
+	if err != nil {
+		return nil, err
+	}
+	return backend.GetMetadata(ctx, path)
+}
+
+// List merges the paths of the mount of prefix with those of every mount below prefix.
+// Paths a mount holds below the prefix of another mount are hidden, like files under a mount point.
+func (b *RouterBackend) List(ctx context.Context, prefix string) ([]Metadata, error) {
+	result := []Metadata{}
+	owner, err := b.route(prefix)
+	if err != nil {
+		owner = -1
+	}
+	for i, mount := range b.mounts {
+		listPrefix := prefix
+		if i != owner {
+			if !HasPathPrefix(mount.Prefix, prefix) {
+				continue
+			}
+			listPrefix = mount.Prefix
+		}
+		list, err := mount.Backend.List(ctx, listPrefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, metadata := range list {
+			if j, err := b.route(metadata.Path); err == nil && j == i {
+				result = append(result, metadata)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// Batch sends the changes to their mount, rejecting them before any write when they belong to more than one mount
+func (b *RouterBackend) Batch(ctx context.Context, changes []Change) ([]Metadata, error) {
+	if len(changes) == 0 {
+		return []Metadata{}, nil
+	}
+	mount := -1
+	for _, change := range changes {
+		i, err := b.route(change.Path)
+		if err != nil {
+			return nil, err
+		}
+		if mount != -1 && i != mount {
+			return nil, fmt.Errorf("changes of %s and %s belong to different mounts and cannot be applied atomically", changes[0].Path, change.Path)
+		}
+		mount = i
+	}
+	return b.mounts[mount].Backend.Batch(ctx, changes)
+}
+
+// Close closes every child, returning the first error
+func (b *RouterBackend) Close(ctx context.Context) error {
+	var result error
+	for _, mount := range b.mounts {
+		if err := mount.Backend.Close(ctx); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
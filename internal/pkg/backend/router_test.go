@@ -0,0 +1,102 @@
+package backend_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/backend/backendtest"
+)
+
+var _ = Describe("Router", func() {
+	backendtest.Conformance(func(ctx context.Context) backend.Backend {
+		router, err := backend.NewRouterBackend([]backend.Mount{
+			{Prefix: "/", Backend: backend.NewMemoryBackend()},
+			{Prefix: "/a/b", Backend: backend.NewMemoryBackend()},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return router
+	})
+
+	Describe("mounts", func() {
+		var root, secrets, nested *backend.MemoryBackend
+		var router backend.Backend
+
+		BeforeEach(func() {
+			var err error
+			root, secrets, nested = backend.NewMemoryBackend(), backend.NewMemoryBackend(), backend.NewMemoryBackend()
+			router, err = backend.NewRouterBackend([]backend.Mount{
+				{Prefix: "/", Backend: root},
+				{Prefix: "/secrets/", Backend: secrets},
+				{Prefix: "/secrets/nested", Backend: nested},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject a prefix mounted twice", func() {
+			_, err := backend.NewRouterBackend([]backend.Mount{{Prefix: "/a", Backend: root}, {Prefix: "/a/", Backend: secrets}})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should dispatch by the longest prefix", func(ctx context.Context) {
+			Expect(router.Set(ctx, "/secrets", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(router.Set(ctx, "/secrets/nested/a", "2", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(router.Set(ctx, "/secretsX", "3", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+
+			Expect(secrets.GetCurrent(ctx, "/secrets")).To(Equal("1"))
+			Expect(nested.GetCurrent(ctx, "/secrets/nested/a")).To(Equal("2"))
+			Expect(root.GetCurrent(ctx, "/secretsX")).To(Equal("3"))
+			Expect(router.GetCurrent(ctx, "/secrets/nested/a")).To(Equal("2"))
+		})
+
+		It("should list across mounts and hide shadowed paths", func(ctx context.Context) {
+			Expect(root.Set(ctx, "/secrets/hidden", "0", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(router.Set(ctx, "/a", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(router.Set(ctx, "/secrets/b", "2", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(router.Set(ctx, "/secrets/nested/c", "3", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+
+			list, err := router.List(ctx, "/")
+			Expect(err).NotTo(HaveOccurred())
+			paths := []string{}
+			for _, metadata := range list {
+				paths = append(paths, metadata.Path)
+			}
+			Expect(paths).To(Equal([]string{"/a", "/secrets/b", "/secrets/nested/c"}))
+
+			list, err = router.List(ctx, "/secrets/nested")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(HaveLen(1))
+		})
+
+		It("should reject batches spanning mounts before writing", func(ctx context.Context) {
+			_, err := router.Batch(ctx, []backend.Change{
+				{Path: "/secrets/a", Values: []string{"1"}},
+				{Path: "/b", Values: []string{"2"}},
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(secrets.List(ctx, "/")).To(BeEmpty())
+			Expect(root.List(ctx, "/")).To(BeEmpty())
+
+			result, err := router.Batch(ctx, []backend.Change{
+				{Path: "/secrets/a", Values: []string{"1"}},
+				{Path: "/secrets/c", Delete: true},
+				{Path: "/secrets/d", Values: []string{"3"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(HaveLen(2))
+			Expect(secrets.GetCurrent(ctx, "/secrets/d")).To(Equal("3"))
+		})
+
+		It("should only support revisions with a single mount", func(ctx context.Context) {
+			Expect(router.Revision(ctx)).Error().To(MatchError(backend.ErrRevisionsUnsupported))
+
+			single, err := backend.NewRouterBackend([]backend.Mount{{Prefix: "/", Backend: root}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(single.Set(ctx, "/a", "1", backend.SetOptions{})).Error().NotTo(HaveOccurred())
+			Expect(single.Revision(ctx)).To(Equal(1))
+			Expect(single.GetVersionsAtRevision(ctx, []string{"/a"}, 1)).To(Equal([]int{1}))
+		})
+	})
+})
@@ -22,7 +22,39 @@ CREATE TABLE IF NOT EXISTS config_metadata (
   latest_version int NOT NULL DEFAULT 0,
   current_version int NOT NULL DEFAULT 0,
   created_at timestamp DEFAULT (now()),  
-  updated_at timestamp DEFAULT (now()) 
+  updated_at timestamp DEFAULT (now()),
+  revision int NOT NULL DEFAULT 0
 );
 
+CREATE TABLE IF NOT EXISTS config_current_versions (
+  id INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  path varchar(2048) NOT NULL,
+  version int NOT NULL,
+  current_at timestamp DEFAULT (now()),
+  revision int NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS config_current_versions_path_current_at ON config_current_versions (path, current_at);
+
+-- a single row counting the writes, locked by each write until it commits
+CREATE TABLE IF NOT EXISTS config_revision (
+  id int PRIMARY KEY,
+  revision int NOT NULL DEFAULT 0
+);
+
+-- columns added after the tables were first created
+ALTER TABLE config_metadata ADD COLUMN IF NOT EXISTS revision int NOT NULL DEFAULT 0;
+ALTER TABLE config_current_versions ADD COLUMN IF NOT EXISTS revision int NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS config_current_versions_path_revision ON config_current_versions (path, revision);
+
+-- the current versions of paths written before config_current_versions was added, current since their values were
+-- written and from revision 0, so that reads at any revision include them
+INSERT INTO config_current_versions (path, version, current_at, revision)
+SELECT m.path, m.current_version, COALESCE(
+  (SELECT MIN(c.created_at) FROM config c WHERE c.path = m.path AND c.version = m.current_version),
+  m.updated_at
+), 0 FROM config_metadata m
+WHERE m.current_version > 0 AND NOT EXISTS (SELECT 1 FROM config_current_versions c WHERE c.path = m.path);
+
 ALTER TABLE config ADD FOREIGN KEY (value_provider_id) REFERENCES value_providers (id);
\ No newline at end of file
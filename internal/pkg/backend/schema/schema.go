@@ -5,6 +5,39 @@ import _ "embed"
 //go:embed config.sql
 var schema string
 
+//go:embed sqlite.sql
+var sqliteSchema string
+
+//go:embed sqlite_backfill.sql
+var sqliteBackfill string
+
 func GetSchema() string {
 	return schema
 }
+
+// GetSQLiteSchema returns the tables of config.sql in the SQLite dialect
+func GetSQLiteSchema() string {
+	return sqliteSchema
+}
+
+// Column is a column added to a table after it was first created
+type Column struct {
+	Table      string
+	Name       string
+	Definition string
+}
+
+// GetSQLiteColumns returns the columns of sqlite.sql which tables created by an earlier schema lack,
+// as SQLite cannot add a column only when it does not exist
+func GetSQLiteColumns() []Column {
+	return []Column{
+		{Table: "config_metadata", Name: "revision", Definition: "int NOT NULL DEFAULT 0"},
+		{Table: "config_current_versions", Name: "revision", Definition: "int NOT NULL DEFAULT 0"},
+	}
+}
+
+// GetSQLiteBackfill returns the statements which run once the columns of GetSQLiteColumns exist: the indexes on them,
+// and the statements filling the tables of sqlite.sql for rows written before they were added
+func GetSQLiteBackfill() string {
+	return sqliteBackfill
+}
@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS value_providers (
+  id varchar(128) PRIMARY KEY,
+  method varchar(128) NOT NULL,
+  payload text NOT NULL,
+  created_at timestamp DEFAULT CURRENT_TIMESTAMP,
+  updated_at timestamp DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS config (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  version int NOT NULL,
+  path varchar(2048) NOT NULL,
+  value varchar(2048) NOT NULL,
+  value_provider_id varchar(128) REFERENCES value_providers (id),
+  created_at timestamp DEFAULT CURRENT_TIMESTAMP,
+  updated_at timestamp DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS config_path_version ON config (path, version);
+
+CREATE TABLE IF NOT EXISTS config_metadata (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  path varchar(2048) NOT NULL UNIQUE,
+  latest_version int NOT NULL DEFAULT 0,
+  current_version int NOT NULL DEFAULT 0,
+  created_at timestamp DEFAULT CURRENT_TIMESTAMP,
+  updated_at timestamp DEFAULT CURRENT_TIMESTAMP,
+  revision int NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS config_current_versions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  path varchar(2048) NOT NULL,
+  version int NOT NULL,
+  current_at timestamp DEFAULT CURRENT_TIMESTAMP,
+  revision int NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS config_current_versions_path_current_at ON config_current_versions (path, current_at);
+
+-- a single row counting the writes, locked by each write until it commits
+CREATE TABLE IF NOT EXISTS config_revision (
+  id int PRIMARY KEY,
+  revision int NOT NULL DEFAULT 0
+);
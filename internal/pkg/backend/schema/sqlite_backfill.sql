@@ -0,0 +1,11 @@
+CREATE INDEX IF NOT EXISTS config_current_versions_path_revision ON config_current_versions (path, revision);
+
+-- the current versions of paths written before config_current_versions was added, current since their values were
+-- written and from revision 0, so that reads at any revision include them. The times are normalized to UTC, which
+-- config_current_versions is compared in, as earlier versions wrote local times.
+INSERT INTO config_current_versions (path, version, current_at, revision)
+SELECT m.path, m.current_version, strftime('%Y-%m-%d %H:%M:%f', COALESCE(
+  (SELECT MIN(c.created_at) FROM config c WHERE c.path = m.path AND c.version = m.current_version),
+  m.updated_at
+)) || '+00:00', 0 FROM config_metadata m
+WHERE m.current_version > 0 AND NOT EXISTS (SELECT 1 FROM config_current_versions c WHERE c.path = m.path);
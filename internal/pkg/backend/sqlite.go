@@ -0,0 +1,416 @@
+package backend
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+type SQLiteConfig struct {
+	// Path of the database file, created when it does not exist
+	Path string `mapstructure:"path" validate:"required"`
+}
+
+// SQLiteBackend stores the config in the tables of schema/sqlite.sql, which mirror the postgres schema.
+// The tables are created by the migrate command.
+type SQLiteBackend struct {
+	DB *sql.DB
+}
+
+// OpenSQLite opens the database file of config.
+// Transactions take the write lock when they begin and wait for each other, instead of failing with SQLITE_BUSY.
+func OpenSQLite(config SQLiteConfig) (*sql.DB, error) {
+	dsn := url.URL{
+		Scheme:   "file",
+		Opaque:   (&url.URL{Path: config.Path}).EscapedPath(),
+		RawQuery: "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate&_time_format=sqlite",
+	}
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", config.Path, err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", config.Path, err)
+	}
+	return db, nil
+}
+
+func NewSQLiteBackend(config SQLiteConfig) (Backend, error) {
+	db, err := OpenSQLite(config)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteBackend{DB: db}, nil
+}
+
+func (b *SQLiteBackend) GetCurrent(ctx context.Context, path string) (string, error) {
+	result, err := b.GetManyCurrent(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if len(result) < 1 {
+		return "", &NotFoundErr{Path: path}
+	}
+	return result[0], nil
+}
+
+func (b *SQLiteBackend) Get(ctx context.Context, path string, version int) (string, error) {
+	result, err := b.GetMany(ctx, path, version)
+	if err != nil {
+		return "", err
+	}
+	if len(result) < 1 {
+		return "", &NotFoundErr{Path: path}
+	}
+	return result[0], nil
+}
+
+func (b *SQLiteBackend) GetManyCurrent(ctx context.Context, path string) ([]string, error) {
+	rows, err := b.DB.QueryContext(
+		ctx,
+		`SELECT config.value FROM config
+		INNER JOIN config_metadata ON config.path = config_metadata.path AND config.version = config_metadata.current_version
+		WHERE config.path = ? ORDER BY config.id`,
+		path,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rows: %w", err)
+	}
+	return scanValues(rows)
+}
+
+func (b *SQLiteBackend) GetMany(ctx context.Context, path string, version int) ([]string, error) {
+	rows, err := b.DB.QueryContext(ctx, `SELECT value FROM config WHERE path = ? AND version = ? ORDER BY id`, path, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rows: %w", err)
+	}
+	return scanValues(rows)
+}
+
+func (b *SQLiteBackend) GetManyPaths(ctx context.Context, selections []Selection) ([][]string, error) {
+	input := make([][]any, len(selections))
+	for i, selection := range selections {
+		input[i] = []any{selection.Path, selection.Version}
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	// the selections are passed as a JSON array of [path, version], which json_each turns into rows
+	rows, err := b.DB.QueryContext(
+		ctx,
+		`WITH s AS (SELECT key AS i, json_extract(value, '$[0]') AS path, json_extract(value, '$[1]') AS version FROM json_each(?))
+		SELECT s.i, config.value FROM s
+		LEFT JOIN config_metadata ON config_metadata.path = s.path
+		INNER JOIN config ON config.path = s.path
+			AND config.version = CASE WHEN s.version = -1 THEN config_metadata.current_version ELSE s.version END
+		ORDER BY s.i, config.id`,
+		string(data),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rows: %w", err)
+	}
+	defer rows.Close()
+	result := make([][]string, len(selections))
+	for i := range result {
+		result[i] = []string{}
+	}
+	for rows.Next() {
+		var i int
+		var value string
+		if err := rows.Scan(&i, &value); err != nil {
+			return nil, err
+		}
+		result[i] = append(result[i], value)
+	}
+	return result, rows.Err()
+}
+
+func scanValues(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	result := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, rows.Err()
+}
+
+func (b *SQLiteBackend) Set(ctx context.Context, path, value string, options SetOptions) (*Metadata, error) {
+	return b.SetMany(ctx, path, []string{value}, options)
+}
+
+func (b *SQLiteBackend) SetMany(ctx context.Context, path string, values []string, options SetOptions) (*Metadata, error) {
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	revision, err := sqliteNextRevision(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := b.setMany(ctx, tx, path, values, options, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// sqliteNextRevision increments the global revision inside tx, returning the new revision
+func sqliteNextRevision(ctx context.Context, tx *sql.Tx) (int, error) {
+	var revision int
+	row := tx.QueryRowContext(
+		ctx,
+		`INSERT INTO config_revision (id, revision) VALUES (1, 1)
+		ON CONFLICT (id) DO UPDATE SET revision = config_revision.revision + 1 RETURNING revision`,
+	)
+	if err := row.Scan(&revision); err != nil {
+		return 0, fmt.Errorf("failed to increment the revision: %w", err)
+	}
+	return revision, nil
+}
+
+// setMany writes values as a new version of path at revision inside tx, creating the metadata entry when needed
+func (b *SQLiteBackend) setMany(ctx context.Context, tx *sql.Tx, path string, values []string, options SetOptions, revision int) (*Metadata, error) {
+	// the times are compared as text, so they are all stored in UTC
+	now := time.Now().UTC()
+	created, err := tx.ExecContext(ctx, `INSERT INTO config_metadata (path, created_at, updated_at) VALUES (?, ?, ?) ON CONFLICT (path) DO NOTHING`, path, now, now)
+	if err != nil {
+		return nil, err
+	}
+	if count, err := created.RowsAffected(); err != nil {
+		return nil, err
+	} else if count > 0 {
+		// the path starts again from the first version, so the versions of a deleted path are forgotten
+		if _, err := tx.ExecContext(ctx, `DELETE FROM config WHERE path = ?`, path); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM config_current_versions WHERE path = ?`, path); err != nil {
+			return nil, err
+		}
+	}
+
+	var metadata Metadata
+	row := tx.QueryRowContext(
+		ctx,
+		`UPDATE config_metadata SET latest_version = latest_version + 1, current_version = CASE WHEN ? THEN current_version ELSE latest_version + 1 END, updated_at = ?, revision = ?
+		WHERE path = ? RETURNING path, latest_version, current_version, created_at, updated_at, revision`,
+		options.KeepCurrent,
+		now,
+		revision,
+		path,
+	)
+	if err := row.Scan(&metadata.Path, &metadata.LatestVersion, &metadata.CurrentVersion, &metadata.CreatedAt, &metadata.UpdatedAt, &metadata.Revision); err != nil {
+		return nil, err
+	}
+	// the transaction is rolled back on conflicts, undoing the update
+	if err := checkExpectedVersion(path, metadata.LatestVersion-1, options); err != nil {
+		return nil, err
+	}
+	if !options.KeepCurrent {
+		_, err := tx.ExecContext(ctx, `INSERT INTO config_current_versions (path, version, current_at, revision) VALUES (?, ?, ?, ?)`, path, metadata.CurrentVersion, now, revision)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO config (path, version, value, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	for _, value := range values {
+		if _, err := stmt.ExecContext(ctx, path, metadata.LatestVersion, value, now, now); err != nil {
+			return nil, err
+		}
+	}
+	return &metadata, nil
+}
+
+func (b *SQLiteBackend) GetMetadata(ctx context.Context, path string) (*Metadata, error) {
+	var metadata Metadata
+	row := b.DB.QueryRowContext(ctx, `SELECT path, latest_version, current_version, created_at, updated_at, revision FROM config_metadata WHERE path = ?`, path)
+	if err := row.Scan(&metadata.Path, &metadata.LatestVersion, &metadata.CurrentVersion, &metadata.CreatedAt, &metadata.UpdatedAt, &metadata.Revision); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &NotFoundErr{Path: path}
+		}
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+func (b *SQLiteBackend) GetManyMetadata(ctx context.Context, paths []string) ([]*Metadata, error) {
+	data, err := json.Marshal(paths)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := b.DB.QueryContext(
+		ctx,
+		`WITH p AS (SELECT key AS i, value AS path FROM json_each(?))
+		SELECT p.i, m.path, m.latest_version, m.current_version, m.created_at, m.updated_at, m.revision FROM p
+		INNER JOIN config_metadata m ON m.path = p.path`,
+		string(data),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rows: %w", err)
+	}
+	defer rows.Close()
+	result := make([]*Metadata, len(paths))
+	for rows.Next() {
+		var i int
+		var metadata Metadata
+		if err := rows.Scan(&i, &metadata.Path, &metadata.LatestVersion, &metadata.CurrentVersion, &metadata.CreatedAt, &metadata.UpdatedAt, &metadata.Revision); err != nil {
+			return nil, err
+		}
+		result[i] = &metadata
+	}
+	return result, rows.Err()
+}
+
+func (b *SQLiteBackend) GetVersionsAt(ctx context.Context, paths []string, at time.Time) ([]int, error) {
+	// the times are compared as text, so they are all stored in UTC
+	return b.getVersions(ctx, paths, `current_at <= ?`, `current_at DESC, id DESC`, at.UTC())
+}
+
+func (b *SQLiteBackend) Revision(ctx context.Context) (int, error) {
+	var revision int
+	row := b.DB.QueryRowContext(ctx, `SELECT COALESCE(MAX(revision), 0) FROM config_revision`)
+	if err := row.Scan(&revision); err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+func (b *SQLiteBackend) GetVersionsAtRevision(ctx context.Context, paths []string, revision int) ([]int, error) {
+	return b.getVersions(ctx, paths, `revision <= ?`, `revision DESC, id DESC`, revision)
+}
+
+// getVersions returns the first version of each path in config_current_versions matching where, in the given order
+func (b *SQLiteBackend) getVersions(ctx context.Context, paths []string, where, order string, arg any) ([]int, error) {
+	data, err := json.Marshal(paths)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := b.DB.QueryContext(
+		ctx,
+		`WITH p AS (SELECT key AS i, value AS path FROM json_each(?))
+		SELECT p.i, (
+			SELECT version FROM config_current_versions
+			WHERE config_current_versions.path = p.path AND `+where+`
+			ORDER BY `+order+` LIMIT 1
+		) FROM p`,
+		string(data),
+		arg,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rows: %w", err)
+	}
+	defer rows.Close()
+	result := make([]int, len(paths))
+	for rows.Next() {
+		var i int
+		var version sql.NullInt64
+		if err := rows.Scan(&i, &version); err != nil {
+			return nil, err
+		}
+		result[i] = int(version.Int64)
+	}
+	return result, rows.Err()
+}
+
+func (b *SQLiteBackend) List(ctx context.Context, prefix string) ([]Metadata, error) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	// LIKE is case insensitive in SQLite, so the children are matched by comparing the leading characters instead
+	rows, err := b.DB.QueryContext(
+		ctx,
+		`SELECT path, latest_version, current_version, created_at, updated_at, revision FROM config_metadata
+		WHERE path = ?1 OR substr(path, 1, length(?2)) = ?2
+		ORDER BY path`,
+		prefix,
+		prefix+"/",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rows: %w", err)
+	}
+	defer rows.Close()
+	result := []Metadata{}
+	for rows.Next() {
+		var metadata Metadata
+		err = rows.Scan(&metadata.Path, &metadata.LatestVersion, &metadata.CurrentVersion, &metadata.CreatedAt, &metadata.UpdatedAt, &metadata.Revision)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, metadata)
+	}
+	return result, rows.Err()
+}
+
+func (b *SQLiteBackend) Batch(ctx context.Context, changes []Change) ([]Metadata, error) {
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := []Metadata{}
+	if len(changes) == 0 {
+		return result, nil
+	}
+	revision, err := sqliteNextRevision(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if change.Delete {
+			if err := b.delete(ctx, tx, change.Path, revision); err != nil {
+				return nil, fmt.Errorf("failed to delete %s: %w", change.Path, err)
+			}
+			continue
+		}
+		metadata, err := b.setMany(ctx, tx, change.Path, change.Values, change.Options, revision)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", change.Path, err)
+		}
+		result = append(result, *metadata)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// delete removes the metadata entry of path inside tx and records the delete as version 0 becoming current at revision.
+// The versions are kept for the reads before the delete, until the path is written again.
+func (b *SQLiteBackend) delete(ctx context.Context, tx *sql.Tx, path string, revision int) error {
+	deleted, err := tx.ExecContext(ctx, `DELETE FROM config_metadata WHERE path = ?`, path)
+	if err != nil {
+		return err
+	}
+	if count, err := deleted.RowsAffected(); err != nil || count == 0 {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO config_current_versions (path, version, current_at, revision) VALUES (?, 0, ?, ?)`, path, time.Now().UTC(), revision)
+	return err
+}
+
+func (b *SQLiteBackend) Close(context.Context) error {
+	return b.DB.Close()
+}
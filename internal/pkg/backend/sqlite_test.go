@@ -0,0 +1,42 @@
+package backend_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/backend/backendtest"
+	"github.com/laminatedio/dendrite/internal/pkg/backend/schema"
+)
+
+var _ = Describe("SQLite", func() {
+	backendtest.Conformance(func(ctx context.Context) backend.Backend {
+		config := backend.SQLiteConfig{Path: filepath.Join(GinkgoT().TempDir(), "dendrite.db")}
+		db, err := backend.OpenSQLite(config)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.ExecContext(ctx, schema.GetSQLiteSchema())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(db.Close()).To(Succeed())
+
+		sqliteBackend, err := backend.NewSQLiteBackend(config)
+		Expect(err).NotTo(HaveOccurred())
+		return sqliteBackend
+	})
+
+	It("should open a file whose path contains URI delimiters", func(ctx context.Context) {
+		config := backend.SQLiteConfig{Path: filepath.Join(GinkgoT().TempDir(), "dendrite?mode=ro#1 %41.db")}
+		db, err := backend.OpenSQLite(config)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		_, err = db.ExecContext(ctx, schema.GetSQLiteSchema())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Stat(config.Path)).Error().NotTo(HaveOccurred())
+		var foreignKeys int
+		Expect(db.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys)).To(Succeed())
+		Expect(foreignKeys).To(Equal(1))
+	})
+})
@@ -5,6 +5,8 @@ import (
 	"os"
 
 	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/dendrite"
+	"github.com/laminatedio/dendrite/internal/pkg/drift"
 
 	"github.com/astaclinic/astafx/httpfx"
 	"github.com/astaclinic/astafx/loggerfx"
@@ -16,11 +18,13 @@ import (
 )
 
 type Config struct {
-	fx.Out  `yaml:"-"`
-	Http    *httpfx.HttpConfig     `validate:"required"`
-	Logs    *loggerfx.LoggerConfig `validate:"required"`
-	Sentry  *sentryfx.SentryConfig `validate:"required"`
-	Backend *backend.Config        `validate:"required"`
+	fx.Out        `yaml:"-"`
+	Http          *httpfx.HttpConfig           `validate:"required"`
+	Logs          *loggerfx.LoggerConfig       `validate:"required"`
+	Sentry        *sentryfx.SentryConfig       `validate:"required"`
+	Backend       *backend.Config              `validate:"required"`
+	Drift         *drift.Config                `validate:"required"`
+	Subscriptions *dendrite.SubscriptionConfig `validate:"required"`
 }
 
 func NewConfig(validate *validator.Validate) (Config, error) {
@@ -1,48 +1,182 @@
 package dendrite
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/laminatedio/dendrite/internal/pkg/backend"
 	"github.com/laminatedio/dendrite/internal/pkg/dendrite/dto"
 	"go.uber.org/zap"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/vektah/gqlparser/v2/ast"
 )
 
 type Error struct {
 	Message string `json:"message"`
 }
 
+// RevisionHeader is the response header holding the global revision a response reflects.
+// Writes return the revision they wrote, reads at a revision return that revision, and other reads return
+// the latest revision before reading, which the values read are at least as new as.
+const RevisionHeader = "Dendrite-Revision"
+
+// OutputHeader is the request header selecting the output mode, like the output query parameter which takes precedence.
+// Queries support every mode, while export and bulk gets support the nested and flat modes.
+const OutputHeader = "Dendrite-Output"
+
+// errorStatus maps errors from the backend to the HTTP status code of the response
+func errorStatus(err error) int {
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		return http.StatusBadRequest
+	}
+	var notFoundErr *backend.NotFoundErr
+	if errors.As(err, &notFoundErr) {
+		return http.StatusNotFound
+	}
+	var conflictErr *backend.ConflictErr
+	if errors.As(err, &conflictErr) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
 type DendriteController struct {
-	dendriteService *DendriteService
-	logger          *zap.SugaredLogger
-	config          *backend.Config
+	dendriteService    *DendriteService
+	logger             *zap.SugaredLogger
+	config             *backend.Config
+	subscriptionConfig *SubscriptionConfig
 }
 
-func NewDendriteController(dendriteService *DendriteService, logger *zap.SugaredLogger, config *backend.Config) *DendriteController {
+func NewDendriteController(dendriteService *DendriteService, logger *zap.SugaredLogger, config *backend.Config, subscriptionConfig *SubscriptionConfig) *DendriteController {
 	return &DendriteController{
-		dendriteService: dendriteService,
-		logger:          logger,
-		config:          config,
+		dendriteService:    dendriteService,
+		logger:             logger,
+		config:             config,
+		subscriptionConfig: subscriptionConfig,
+	}
+}
+
+// QueryResponse is the standard response of a GraphQL request
+type QueryResponse struct {
+	Data   any     `json:"data,omitempty"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+// bindQueryParameters reads a GraphQL request from the URL parameters of a GET request
+func bindQueryParameters(ctx *gin.Context, input *dto.QueryInput) error {
+	input.Query = ctx.Query("query")
+	input.OperationName = ctx.Query("operationName")
+	if revision := ctx.Query("revision"); revision != "" {
+		value, err := strconv.Atoi(revision)
+		if err != nil {
+			return err
+		}
+		input.Revision = &value
+	}
+	if variables := ctx.Query("variables"); variables != "" {
+		return json.Unmarshal([]byte(variables), &input.Variables)
+	}
+	return nil
+}
+
+// outputMode returns the output mode of the output query parameter or OutputHeader, empty when neither is set
+func outputMode(ctx *gin.Context) dto.OutputMode {
+	if mode := ctx.Query("output"); mode != "" {
+		return dto.OutputMode(mode)
+	}
+	return dto.OutputMode(ctx.GetHeader(OutputHeader))
+}
+
+// flatOutput reports whether a request other than a query selects the flat output rather than the nested one
+func flatOutput(ctx *gin.Context) (bool, error) {
+	switch mode := outputMode(ctx); mode {
+	case "", dto.OutputNested:
+		return false, nil
+	case dto.OutputFlat:
+		return true, nil
+	default:
+		return false, queryErrorf("unknown output mode %s, expected %s or %s", mode, dto.OutputNested, dto.OutputFlat)
+	}
+}
+
+// flatVersion returns the flat output of a single path, which is empty when the version has no values
+func flatVersion(path string, version dto.Version) map[string]dto.Version {
+	output := map[string]dto.Version{}
+	if len(version.Values) > 0 {
+		output[path] = version
+	}
+	return output
+}
+
+// setRevision sets the revision header of the response, unless the revision is unknown (-1)
+func setRevision(ctx *gin.Context, revision int) {
+	if revision >= 0 {
+		ctx.Header(RevisionHeader, strconv.Itoa(revision))
+	}
+}
+
+// readRevision sets the revision header to the latest revision, it is called before reading.
+// The header is left out when the backend does not support revisions.
+func (c *DendriteController) readRevision(ctx *gin.Context) {
+	revision, err := c.dendriteService.Revision(ctx)
+	if err != nil {
+		if !errors.Is(err, backend.ErrRevisionsUnsupported) {
+			c.logger.Warnf("failed to get the latest revision: %v", err)
+		}
+		return
 	}
+	setRevision(ctx, revision)
+}
+
+// isMutation reports whether input runs a mutation, invalid requests are left to Execute to report
+func isMutation(input dto.QueryInput) bool {
+	operation, err := parseOperation(input)
+	return err == nil && operation.Operation == ast.Mutation
 }
 
 func (c *DendriteController) Query(ctx *gin.Context) {
-	json := &dto.QueryInput{}
-	err := ctx.BindJSON(json)
+	if websocket.IsWebSocketUpgrade(ctx.Request) {
+		c.subscribe(ctx)
+		return
+	}
+	input := &dto.QueryInput{}
+	var err error
+	if ctx.Request.Method == http.MethodGet {
+		err = bindQueryParameters(ctx, input)
+	} else {
+		err = ctx.BindJSON(input)
+	}
+	if input.Output == "" {
+		input.Output = outputMode(ctx)
+	}
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, Error{
-			Message: "failed to parse body, please check whether the request body is valid",
+		ctx.JSON(http.StatusBadRequest, QueryResponse{
+			Errors: []Error{{Message: "failed to parse the request, please check whether the query and variables are valid"}},
+		})
+	} else if ctx.Request.Method == http.MethodGet && isMutation(*input) {
+		// GET requests may be repeated by caches and proxies, so they must not write
+		ctx.JSON(http.StatusMethodNotAllowed, QueryResponse{
+			Errors: []Error{{Message: "mutations must be sent with POST"}},
 		})
 	} else {
-		object, err := c.dendriteService.Query(ctx, json.Query)
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, Error{
-				Message: "failed to query: " + err.Error(),
+		object, revision, err := c.dendriteService.ExecuteWithRevision(ctx, *input)
+		setRevision(ctx, revision)
+		var queryErr *QueryError
+		if errors.As(err, &queryErr) {
+			ctx.JSON(http.StatusBadRequest, QueryResponse{
+				Errors: []Error{{Message: queryErr.Message}},
+			})
+		} else if err != nil {
+			ctx.JSON(errorStatus(err), QueryResponse{
+				Errors: []Error{{Message: "failed to run the operation: " + err.Error()}},
 			})
 		} else {
-			ctx.JSON(http.StatusOK, object)
+			ctx.JSON(http.StatusOK, QueryResponse{Data: object})
 		}
 	}
 }
@@ -55,9 +189,21 @@ func (c *DendriteController) GetCurrent(ctx *gin.Context) {
 			Message: "failed to parse body, please check whether the request body is valid",
 		})
 	} else {
-		value, err := c.dendriteService.backend.GetCurrent(ctx, json.Path)
+		c.readRevision(ctx)
+		var value string
+		if json.AsOf != nil {
+			var values []string
+			values, err = c.dendriteService.GetManyAt(ctx, json.Path, *json.AsOf)
+			if err == nil && len(values) < 1 {
+				err = &backend.NotFoundErr{Path: json.Path}
+			} else if err == nil {
+				value = values[0]
+			}
+		} else {
+			value, err = c.dendriteService.backend.GetCurrent(ctx, json.Path)
+		}
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, Error{
+			ctx.JSON(errorStatus(err), Error{
 				Message: err.Error(),
 			})
 		} else {
@@ -76,9 +222,10 @@ func (c *DendriteController) Get(ctx *gin.Context) {
 			Message: "failed to parse body, please check whether the request body is valid",
 		})
 	} else {
+		c.readRevision(ctx)
 		value, err := c.dendriteService.backend.Get(ctx, json.Path, json.Version)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, Error{
+			ctx.JSON(errorStatus(err), Error{
 				Message: err.Error(),
 			})
 		} else {
@@ -97,9 +244,33 @@ func (c *DendriteController) GetManyCurrent(ctx *gin.Context) {
 			Message: "failed to parse body, please check whether the request body is valid",
 		})
 	} else {
-		values, err := c.dendriteService.backend.GetManyCurrent(ctx, json.Path)
+		flat, err := flatOutput(ctx)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, Error{
+			ctx.JSON(errorStatus(err), Error{
+				Message: err.Error(),
+			})
+			return
+		}
+		c.readRevision(ctx)
+		if flat {
+			version, err := c.dendriteService.GetCurrentVersion(ctx, json.Path, json.AsOf)
+			if err != nil {
+				ctx.JSON(errorStatus(err), Error{
+					Message: err.Error(),
+				})
+			} else {
+				ctx.JSON(http.StatusOK, flatVersion(json.Path, version))
+			}
+			return
+		}
+		var values []string
+		if json.AsOf != nil {
+			values, err = c.dendriteService.GetManyAt(ctx, json.Path, *json.AsOf)
+		} else {
+			values, err = c.dendriteService.backend.GetManyCurrent(ctx, json.Path)
+		}
+		if err != nil {
+			ctx.JSON(errorStatus(err), Error{
 				Message: err.Error(),
 			})
 		} else {
@@ -118,11 +289,21 @@ func (c *DendriteController) GetMany(ctx *gin.Context) {
 			Message: "failed to parse body, please check whether the request body is valid",
 		})
 	} else {
+		flat, err := flatOutput(ctx)
+		if err != nil {
+			ctx.JSON(errorStatus(err), Error{
+				Message: err.Error(),
+			})
+			return
+		}
+		c.readRevision(ctx)
 		values, err := c.dendriteService.backend.GetMany(ctx, json.Path, json.Version)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, Error{
+			ctx.JSON(errorStatus(err), Error{
 				Message: err.Error(),
 			})
+		} else if flat {
+			ctx.JSON(http.StatusOK, flatVersion(json.Path, dto.Version{Version: json.Version, Values: values}))
 		} else {
 			ctx.JSON(http.StatusOK, map[string][]string{
 				"values": values,
@@ -131,6 +312,63 @@ func (c *DendriteController) GetMany(ctx *gin.Context) {
 	}
 }
 
+func (c *DendriteController) History(ctx *gin.Context) {
+	json := &dto.GetCurrentInput{}
+	err := ctx.BindJSON(json)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, Error{
+			Message: "failed to parse body, please check whether the request body is valid",
+		})
+	} else {
+		c.readRevision(ctx)
+		history, err := c.dendriteService.History(ctx, json.Path)
+		if err != nil {
+			ctx.JSON(errorStatus(err), Error{
+				Message: err.Error(),
+			})
+		} else {
+			ctx.JSON(http.StatusOK, history)
+		}
+	}
+}
+
+func (c *DendriteController) Export(ctx *gin.Context) {
+	json := &dto.ExportInput{}
+	err := ctx.BindJSON(json)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, Error{
+			Message: "failed to parse body, please check whether the request body is valid",
+		})
+	} else {
+		flat, err := flatOutput(ctx)
+		if err != nil {
+			ctx.JSON(errorStatus(err), Error{
+				Message: err.Error(),
+			})
+			return
+		}
+		if json.Revision == nil {
+			c.readRevision(ctx)
+		}
+		var values any
+		if flat {
+			values, err = c.dendriteService.ExportVersions(ctx, *json)
+		} else {
+			values, err = versionValues(c.dendriteService.ExportVersions(ctx, *json))
+		}
+		if err == nil && json.Revision != nil {
+			setRevision(ctx, *json.Revision)
+		}
+		if err != nil {
+			ctx.JSON(errorStatus(err), Error{
+				Message: err.Error(),
+			})
+		} else {
+			ctx.JSON(http.StatusOK, values)
+		}
+	}
+}
+
 func (c *DendriteController) Set(ctx *gin.Context) {
 	json := &dto.SetInput{}
 	err := ctx.BindJSON(json)
@@ -148,6 +386,7 @@ func (c *DendriteController) Set(ctx *gin.Context) {
 			})
 		} else {
 			c.logger.Debugf("(From %v) Created kv with path: %v with value: %v, backend: %v", ctx.ClientIP(), json.Path, json.Value, c.config.Type)
+			setRevision(ctx, object.Revision)
 			ctx.JSON(http.StatusCreated, object)
 		}
 	}
@@ -170,6 +409,7 @@ func (c *DendriteController) SetMany(ctx *gin.Context) {
 			})
 		} else {
 			c.logger.Debugf("(From %v) Created kv with path: %v with values: %v, backend: %v", ctx.ClientIP(), json.Path, json.Values, c.config.Type)
+			setRevision(ctx, object.Revision)
 			ctx.JSON(http.StatusCreated, object)
 		}
 	}
@@ -180,11 +420,14 @@ func (c *DendriteController) RoutePattern() string {
 }
 
 func (c *DendriteController) RegisterControllerRoutes(rg *gin.RouterGroup) {
+	rg.GET("/query", c.Query)
 	rg.POST("/query", c.Query)
 	rg.POST("/get", c.Get)
 	rg.POST("/getMany", c.GetMany)
 	rg.POST("/getCurrent", c.GetCurrent)
 	rg.POST("/getManyCurrent", c.GetManyCurrent)
+	rg.POST("/history", c.History)
+	rg.POST("/export", c.Export)
 	rg.POST("/set", c.Set)
 	rg.POST("/setMany", c.SetMany)
 }
@@ -1,8 +1,86 @@
 package dto
 
+import (
+	"strings"
+	"time"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+)
+
+// Selection is a version of a path to read, Version -1 selects the current version
 type Selection struct {
 	Path    string
 	Version int
+	// At selects the version which was current at that time instead of Version, when it is set
+	At *time.Time
+	// Revision selects the version which was current after the write of that global revision instead of Version, when it is set
+	Revision *int
+	// Key is where the values are placed in the result, which differs from Path when fields are aliased.
+	// The values are placed at Path when it is empty.
+	Key string
+	// Meta selects fields of the metadata of the path rather than its values, they are placed in an object at Key
+	Meta []MetaField
+}
+
+// MetaField is a field of the _meta sub-selection of a leaf
+type MetaField struct {
+	// Key is the name of the field in the result
+	Key  string
+	Name string
+}
+
+// OutputMode selects the shape of the result of a query
+type OutputMode string
+
+const (
+	// OutputNested returns nested objects keyed by path segment, the default. A leaf is a string when it has
+	// a single value and a list otherwise, and a parent is the object of its selected children. A key cannot be
+	// both, so a query selecting a path which has values along with children below it fails, the node output
+	// returns such paths.
+	OutputNested OutputMode = "nested"
+	// OutputNode returns the root Node
+	OutputNode OutputMode = "node"
+	// OutputFlat returns a Version of every key with values, keyed by the full key rather than by segment.
+	// The key of a value is its path, unless a field is aliased.
+	OutputFlat OutputMode = "flat"
+)
+
+// Node is a path of a query result, where every selected key is a node
+type Node struct {
+	// Values are the values read at the node, in the order they were selected
+	Values []string `json:"values,omitempty"`
+	// Meta is the object of a _meta selection, which has neither values nor children
+	Meta map[string]any `json:"meta,omitempty"`
+	// Children are the nodes below, keyed by path segment or alias
+	Children map[string]*Node `json:"children,omitempty"`
+}
+
+// Child returns the node at key below n, a path of segments separated by "/", creating the missing nodes
+func (n *Node) Child(key string) *Node {
+	node := n
+	for _, segment := range strings.Split(strings.Trim(key, "/"), "/") {
+		if node.Children == nil {
+			node.Children = map[string]*Node{}
+		}
+		child, ok := node.Children[segment]
+		if !ok {
+			child = &Node{}
+			node.Children[segment] = child
+		}
+		node = child
+	}
+	return node
+}
+
+type Version struct {
+	Version int      `json:"version"`
+	Values  []string `json:"values"`
+}
+
+type History struct {
+	Metadata backend.Metadata `json:"metadata"`
+	// Versions are ordered from the latest to the oldest
+	Versions []Version `json:"versions"`
 }
 
 type Config struct {
@@ -11,11 +89,27 @@ type Config struct {
 }
 
 type QueryInput struct {
-	Query string `json:"query"`
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+	// Revision runs a query at that global revision, reading the versions which were current after its write
+	Revision *int `json:"revision"`
+	// Output is the shape of the result of queries and subscriptions, OutputNested when empty
+	Output OutputMode `json:"output"`
 }
 
 type GetCurrentInput struct {
 	Path string `json:"path"`
+	// AsOf reads the version which was current at that time rather than the current one, it is ignored by history
+	AsOf *time.Time `json:"asOf"`
+}
+
+type ExportInput struct {
+	Prefix string `json:"prefix"`
+	// AsOf exports the versions which were current at that time rather than the current ones
+	AsOf *time.Time `json:"asOf"`
+	// Revision exports the versions which were current after the write of that global revision, it excludes AsOf
+	Revision *int `json:"revision"`
 }
 
 type GetInput struct {
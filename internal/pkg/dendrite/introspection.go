@@ -0,0 +1,356 @@
+package dendrite
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// inputValue is an argument or an input field, introspected as __InputValue
+type inputValue struct {
+	Name         string
+	Description  string
+	Type         *ast.Type
+	DefaultValue *ast.Value
+	Directives   ast.DirectiveList
+}
+
+// introspection resolves the fields of __schema and __type queries against a schema.
+// Types are introspected as *ast.Type, which are either a reference to a named type of the schema or a list or non null wrapper.
+type introspection struct {
+	schema    *ast.Schema
+	variables map[string]any
+}
+
+// resolve returns the fields of set selected on object, which is an element of the schema
+func (i *introspection) resolve(object any, set ast.SelectionSet) (map[string]any, error) {
+	fields, err := collectFields(set, i.variables)
+	if err != nil {
+		return nil, err
+	}
+	output := map[string]any{}
+	for _, field := range fields {
+		var value any
+		if field.Name == "__typename" {
+			value = introspectionTypeName(object)
+		} else {
+			value, err = i.field(object, field)
+			if err != nil {
+				return nil, err
+			}
+		}
+		value, err = i.complete(value, field.SelectionSet)
+		if err != nil {
+			return nil, err
+		}
+		output[responseKey(field)] = value
+	}
+	return output, nil
+}
+
+// complete resolves the selection set on the objects of value, scalars are returned as they are
+func (i *introspection) complete(value any, set ast.SelectionSet) (any, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		output := make([]any, len(value))
+		for j, element := range value {
+			result, err := i.complete(element, set)
+			if err != nil {
+				return nil, err
+			}
+			output[j] = result
+		}
+		return output, nil
+	case string, bool:
+		return value, nil
+	default:
+		if len(set) == 0 {
+			return nil, queryErrorf("a selection of the fields of %s is required", introspectionTypeName(value))
+		}
+		return i.resolve(value, set)
+	}
+}
+
+func introspectionTypeName(object any) string {
+	switch object.(type) {
+	case *ast.Schema:
+		return "__Schema"
+	case *ast.Type:
+		return "__Type"
+	case *ast.FieldDefinition:
+		return "__Field"
+	case *inputValue:
+		return "__InputValue"
+	case *ast.EnumValueDefinition:
+		return "__EnumValue"
+	case *ast.DirectiveDefinition:
+		return "__Directive"
+	}
+	return ""
+}
+
+// field returns the value of field on object, objects and lists of objects are completed by the caller
+func (i *introspection) field(object any, field *ast.Field) (any, error) {
+	switch object := object.(type) {
+	case *ast.Schema:
+		switch field.Name {
+		case "description":
+			return nullable(object.Description), nil
+		case "types":
+			names := make([]string, 0, len(object.Types))
+			for name := range object.Types {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			output := make([]any, len(names))
+			for j, name := range names {
+				output[j] = ast.NamedType(name, nil)
+			}
+			return output, nil
+		case "queryType":
+			return definitionType(object.Query), nil
+		case "mutationType":
+			return definitionType(object.Mutation), nil
+		case "subscriptionType":
+			return definitionType(object.Subscription), nil
+		case "directives":
+			names := make([]string, 0, len(object.Directives))
+			for name := range object.Directives {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			output := make([]any, len(names))
+			for j, name := range names {
+				output[j] = object.Directives[name]
+			}
+			return output, nil
+		}
+	case *ast.Type:
+		return i.typeField(object, field)
+	case *ast.FieldDefinition:
+		switch field.Name {
+		case "name":
+			return object.Name, nil
+		case "description":
+			return nullable(object.Description), nil
+		case "args":
+			return arguments(object.Arguments), nil
+		case "type":
+			return object.Type, nil
+		case "isDeprecated":
+			return object.Directives.ForName("deprecated") != nil, nil
+		case "deprecationReason":
+			return deprecationReason(object.Directives), nil
+		}
+	case *inputValue:
+		switch field.Name {
+		case "name":
+			return object.Name, nil
+		case "description":
+			return nullable(object.Description), nil
+		case "type":
+			return object.Type, nil
+		case "defaultValue":
+			if object.DefaultValue == nil {
+				return nil, nil
+			}
+			return object.DefaultValue.String(), nil
+		case "isDeprecated":
+			return object.Directives.ForName("deprecated") != nil, nil
+		case "deprecationReason":
+			return deprecationReason(object.Directives), nil
+		}
+	case *ast.EnumValueDefinition:
+		switch field.Name {
+		case "name":
+			return object.Name, nil
+		case "description":
+			return nullable(object.Description), nil
+		case "isDeprecated":
+			return object.Directives.ForName("deprecated") != nil, nil
+		case "deprecationReason":
+			return deprecationReason(object.Directives), nil
+		}
+	case *ast.DirectiveDefinition:
+		switch field.Name {
+		case "name":
+			return object.Name, nil
+		case "description":
+			return nullable(object.Description), nil
+		case "locations":
+			output := make([]any, len(object.Locations))
+			for j, location := range object.Locations {
+				output[j] = string(location)
+			}
+			return output, nil
+		case "args":
+			return arguments(object.Arguments), nil
+		case "isRepeatable":
+			return object.IsRepeatable, nil
+		}
+	}
+	return nil, queryErrorf("cannot query field %s on type %s", field.Name, introspectionTypeName(object))
+}
+
+// typeField returns the value of field on a __Type
+func (i *introspection) typeField(t *ast.Type, field *ast.Field) (any, error) {
+	var definition *ast.Definition
+	if !t.NonNull && t.Elem == nil {
+		definition = i.schema.Types[t.NamedType]
+		if definition == nil {
+			return nil, queryErrorf("unknown type %s", t.NamedType)
+		}
+	}
+	switch field.Name {
+	case "kind":
+		switch {
+		case t.NonNull:
+			return "NON_NULL", nil
+		case t.Elem != nil:
+			return "LIST", nil
+		}
+		return string(definition.Kind), nil
+	case "ofType":
+		switch {
+		case t.NonNull:
+			return &ast.Type{NamedType: t.NamedType, Elem: t.Elem}, nil
+		case t.Elem != nil:
+			return t.Elem, nil
+		}
+		return nil, nil
+	}
+	if definition == nil {
+		// every other field of a wrapper is null
+		switch field.Name {
+		case "name", "description", "specifiedByURL", "fields", "interfaces", "possibleTypes", "enumValues", "inputFields":
+			return nil, nil
+		}
+		return nil, queryErrorf("cannot query field %s on type __Type", field.Name)
+	}
+
+	includeDeprecated, err := argumentValue(field.Arguments, "includeDeprecated", i.variables)
+	if err != nil {
+		return nil, err
+	}
+	switch field.Name {
+	case "name":
+		return definition.Name, nil
+	case "description":
+		return nullable(definition.Description), nil
+	case "specifiedByURL":
+		if directive := definition.Directives.ForName("specifiedBy"); directive != nil {
+			if url := directive.Arguments.ForName("url"); url != nil {
+				return url.Value.Raw, nil
+			}
+		}
+		return nil, nil
+	case "fields":
+		if definition.Kind != ast.Object && definition.Kind != ast.Interface {
+			return nil, nil
+		}
+		output := []any{}
+		for _, f := range definition.Fields {
+			if strings.HasPrefix(f.Name, "__") || (includeDeprecated != true && f.Directives.ForName("deprecated") != nil) {
+				continue
+			}
+			output = append(output, f)
+		}
+		return output, nil
+	case "interfaces":
+		if definition.Kind != ast.Object && definition.Kind != ast.Interface {
+			return nil, nil
+		}
+		output := make([]any, len(definition.Interfaces))
+		for j, name := range definition.Interfaces {
+			output[j] = ast.NamedType(name, nil)
+		}
+		return output, nil
+	case "possibleTypes":
+		if definition.Kind != ast.Interface && definition.Kind != ast.Union {
+			return nil, nil
+		}
+		output := []any{}
+		for _, possible := range i.schema.PossibleTypes[definition.Name] {
+			output = append(output, ast.NamedType(possible.Name, nil))
+		}
+		return output, nil
+	case "enumValues":
+		if definition.Kind != ast.Enum {
+			return nil, nil
+		}
+		output := []any{}
+		for _, value := range definition.EnumValues {
+			if includeDeprecated != true && value.Directives.ForName("deprecated") != nil {
+				continue
+			}
+			output = append(output, value)
+		}
+		return output, nil
+	case "inputFields":
+		if definition.Kind != ast.InputObject {
+			return nil, nil
+		}
+		output := make([]any, len(definition.Fields))
+		for j, f := range definition.Fields {
+			output[j] = &inputValue{Name: f.Name, Description: f.Description, Type: f.Type, DefaultValue: f.DefaultValue, Directives: f.Directives}
+		}
+		return output, nil
+	}
+	return nil, queryErrorf("cannot query field %s on type __Type", field.Name)
+}
+
+// root resolves the __schema and __type fields of the query type
+func (i *introspection) root(field *ast.Field) (any, error) {
+	if field.Name == "__schema" {
+		return i.complete(i.schema, field.SelectionSet)
+	}
+	value, err := argumentValue(field.Arguments, "name", i.variables)
+	if err != nil {
+		return nil, err
+	}
+	name, ok := value.(string)
+	if !ok {
+		return nil, queryErrorf("argument name of __type must be a String")
+	}
+	if i.schema.Types[name] == nil {
+		return nil, nil
+	}
+	return i.complete(ast.NamedType(name, nil), field.SelectionSet)
+}
+
+func definitionType(definition *ast.Definition) any {
+	if definition == nil {
+		return nil
+	}
+	return ast.NamedType(definition.Name, nil)
+}
+
+func arguments(list ast.ArgumentDefinitionList) []any {
+	output := make([]any, len(list))
+	for j, argument := range list {
+		output[j] = &inputValue{Name: argument.Name, Description: argument.Description, Type: argument.Type, DefaultValue: argument.DefaultValue, Directives: argument.Directives}
+	}
+	return output
+}
+
+func deprecationReason(directives ast.DirectiveList) any {
+	directive := directives.ForName("deprecated")
+	if directive == nil {
+		return nil
+	}
+	if reason := directive.Arguments.ForName("reason"); reason != nil {
+		return reason.Value.Raw
+	}
+	return "No longer supported"
+}
+
+// nullable returns nil for empty descriptions, which are null rather than empty in introspection results
+func nullable(description string) any {
+	if description == "" {
+		return nil
+	}
+	return description
+}
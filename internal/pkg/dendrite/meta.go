@@ -0,0 +1,79 @@
+package dendrite
+
+import (
+	"time"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/dendrite/dto"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// metaField is the reserved sub-selection of a leaf returning the metadata of the version read, rather than its value
+const metaField = "_meta"
+
+// getMetaSelections returns the _meta selections of the leaf field, whose collected sub-selections are fields
+func (s *DendriteService) getMetaSelections(field *ast.Field, fields []*ast.Field, base string, key string, variables map[string]any) ([]dto.Selection, error) {
+	version, err := s.GetFieldVersion(field.Arguments, variables)
+	if err != nil {
+		return nil, err
+	}
+	at, err := s.GetFieldTime(field.Arguments, variables)
+	if err != nil {
+		return nil, err
+	}
+	output := []dto.Selection{}
+	for _, f := range fields {
+		if f.Name != metaField {
+			return nil, queryErrorf("%s selects _meta, so it is a leaf and cannot select %s", base, f.Name)
+		}
+		metaFields, err := collectFields(f.SelectionSet, variables)
+		if err != nil {
+			return nil, err
+		}
+		if len(metaFields) == 0 {
+			return nil, queryErrorf("a selection of the fields of _meta is required")
+		}
+		selection := dto.Selection{Path: base, Version: version, At: at, Key: key + "/" + responseKey(f)}
+		for _, m := range metaFields {
+			switch m.Name {
+			case "version", "latestVersion", "updatedAt":
+			default:
+				return nil, queryErrorf("cannot query field %s on _meta, expected version, latestVersion or updatedAt", m.Name)
+			}
+			if len(m.SelectionSet) > 0 {
+				return nil, queryErrorf("field %s of _meta has no fields", m.Name)
+			}
+			selection.Meta = append(selection.Meta, dto.MetaField{Key: responseKey(m), Name: m.Name})
+		}
+		output = append(output, selection)
+	}
+	return output, nil
+}
+
+// metaObject returns the fields selected on the metadata of a path read at version, -1 reading the current version
+func metaObject(metadata *backend.Metadata, version int, fields []dto.MetaField) map[string]any {
+	if version == -1 {
+		version = metadata.CurrentVersion
+	}
+	output := make(map[string]any, len(fields))
+	for _, field := range fields {
+		switch field.Name {
+		case "version":
+			output[field.Key] = version
+		case "latestVersion":
+			output[field.Key] = metadata.LatestVersion
+		case "updatedAt":
+			output[field.Key] = metadata.UpdatedAt.Format(time.RFC3339Nano)
+		}
+	}
+	return output
+}
+
+// getMeta returns the _meta object of selection from the metadata of its path, nil like a value when the version read does not exist
+func getMeta(metadata *backend.Metadata, selection dto.Selection) map[string]any {
+	if metadata == nil || selection.Version > metadata.LatestVersion || selection.Version == 0 || selection.Version < -1 {
+		return nil
+	}
+	return metaObject(metadata, selection.Version, selection.Meta)
+}
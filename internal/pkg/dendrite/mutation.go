@@ -0,0 +1,166 @@
+package dendrite
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// mutate applies the set and setMany fields of a mutation as a single batch, so either every write is applied or none is.
+// Each field returns the metadata of the version it wrote, along with the revision of the batch, -1 when nothing was written.
+func (s *DendriteService) mutate(ctx context.Context, operation *ast.OperationDefinition, variables map[string]any) (map[string]any, int, error) {
+	fields, err := collectFields(operation.SelectionSet, variables)
+	if err != nil {
+		return nil, -1, err
+	}
+	output := map[string]any{}
+	changes := []backend.Change{}
+	writes := []*ast.Field{}
+	for _, field := range fields {
+		key := responseKey(field)
+		if _, ok := output[key]; ok {
+			return nil, -1, queryErrorf("%s is selected more than once", key)
+		}
+		output[key] = nil
+		if field.Name == "__typename" {
+			output[key] = "Mutation"
+			continue
+		}
+		change, err := mutationChange(field, variables)
+		if err != nil {
+			return nil, -1, err
+		}
+		// the selection is checked before anything is written
+		if _, err := metadataFields(backend.Metadata{}, field.SelectionSet, variables); err != nil {
+			return nil, -1, err
+		}
+		changes = append(changes, change)
+		writes = append(writes, field)
+	}
+	if len(changes) == 0 {
+		return output, -1, nil
+	}
+
+	result, err := s.backend.Batch(ctx, changes)
+	if err != nil {
+		return nil, -1, err
+	}
+	for i, field := range writes {
+		metadata, err := metadataFields(result[i], field.SelectionSet, variables)
+		if err != nil {
+			return nil, -1, err
+		}
+		output[responseKey(field)] = metadata
+	}
+	return output, result[0].Revision, nil
+}
+
+// mutationChange returns the change written by a set or setMany field
+func mutationChange(field *ast.Field, variables map[string]any) (backend.Change, error) {
+	change := backend.Change{}
+	value, err := argumentValue(field.Arguments, "path", variables)
+	if err != nil {
+		return change, err
+	}
+	path, ok := value.(string)
+	if !ok || !strings.HasPrefix(path, "/") {
+		return change, queryErrorf("argument path of %s must be a path starting with /", field.Name)
+	}
+	change.Path = path
+
+	switch field.Name {
+	case "set":
+		value, err := argumentValue(field.Arguments, "value", variables)
+		if err != nil {
+			return change, err
+		}
+		if _, ok := value.(string); !ok {
+			return change, queryErrorf("argument value of set must be a String")
+		}
+		change.Values = []string{value.(string)}
+	case "setMany":
+		values, err := argumentValue(field.Arguments, "values", variables)
+		if err != nil {
+			return change, err
+		}
+		list, ok := values.([]any)
+		if !ok {
+			return change, queryErrorf("argument values of setMany must be a list of String")
+		}
+		change.Values = make([]string, len(list))
+		for i, value := range list {
+			if change.Values[i], ok = value.(string); !ok {
+				return change, queryErrorf("argument values of setMany must be a list of String")
+			}
+		}
+	default:
+		return change, queryErrorf("unknown mutation %s, expected set or setMany", field.Name)
+	}
+
+	keepCurrent, err := argumentValue(field.Arguments, "keepCurrent", variables)
+	if err != nil {
+		return change, err
+	}
+	switch keepCurrent := keepCurrent.(type) {
+	case nil:
+	case bool:
+		change.Options.KeepCurrent = keepCurrent
+	default:
+		return change, queryErrorf("argument keepCurrent of %s must be a Boolean", field.Name)
+	}
+
+	expectedVersion, err := argumentValue(field.Arguments, "expectedVersion", variables)
+	if err != nil {
+		return change, err
+	}
+	switch expectedVersion := expectedVersion.(type) {
+	case nil:
+	case int64:
+		version := int(expectedVersion)
+		change.Options.ExpectedVersion = &version
+	case int:
+		change.Options.ExpectedVersion = &expectedVersion
+	default:
+		return change, queryErrorf("argument expectedVersion of %s must be an Int", field.Name)
+	}
+	return change, nil
+}
+
+// metadataFields returns the fields of set selected on metadata
+func metadataFields(metadata backend.Metadata, set ast.SelectionSet, variables map[string]any) (map[string]any, error) {
+	if len(set) == 0 {
+		return nil, queryErrorf("a selection of the fields of Metadata is required")
+	}
+	fields, err := collectFields(set, variables)
+	if err != nil {
+		return nil, err
+	}
+	output := map[string]any{}
+	for _, field := range fields {
+		var value any
+		switch field.Name {
+		case "__typename":
+			value = "Metadata"
+		case "path":
+			value = metadata.Path
+		case "latestVersion":
+			value = metadata.LatestVersion
+		case "currentVersion":
+			value = metadata.CurrentVersion
+		case "createdAt":
+			value = metadata.CreatedAt.Format(time.RFC3339Nano)
+		case "updatedAt":
+			value = metadata.UpdatedAt.Format(time.RFC3339Nano)
+		case "revision":
+			value = metadata.Revision
+		default:
+			return nil, queryErrorf("cannot query field %s on type Metadata", field.Name)
+		}
+		output[responseKey(field)] = value
+	}
+	return output, nil
+}
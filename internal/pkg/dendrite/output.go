@@ -0,0 +1,84 @@
+package dendrite
+
+import (
+	"path"
+
+	"github.com/laminatedio/dendrite/internal/pkg/dendrite/dto"
+)
+
+// parseOutputMode returns the output mode of a request, OutputNested when it is empty
+func parseOutputMode(mode dto.OutputMode) (dto.OutputMode, error) {
+	switch mode {
+	case "":
+		return dto.OutputNested, nil
+	case dto.OutputNested, dto.OutputNode, dto.OutputFlat:
+		return mode, nil
+	}
+	return "", queryErrorf("unknown output mode %s, expected %s, %s or %s", mode, dto.OutputNested, dto.OutputNode, dto.OutputFlat)
+}
+
+// nestedObject renders the children of node, whose key is base, in the nested output.
+// A key with both values and selected children has no place in it, so it is reported as a QueryError.
+func nestedObject(node *dto.Node, base string) (map[string]any, error) {
+	output := make(map[string]any, len(node.Children))
+	for name, child := range node.Children {
+		key := path.Join(base, name)
+		switch {
+		case child.Meta != nil:
+			output[name] = child.Meta
+		case len(child.Children) > 0 && len(child.Values) > 0:
+			return nil, queryErrorf("%s has both values and selected children, which only the %s output can return", key, dto.OutputNode)
+		case len(child.Children) > 0:
+			object, err := nestedObject(child, key)
+			if err != nil {
+				return nil, err
+			}
+			output[name] = object
+		case len(child.Values) == 1:
+			output[name] = child.Values[0]
+		default:
+			output[name] = child.Values
+		}
+	}
+	return output, nil
+}
+
+// flatObject renders the versions of the flat output as the result of a query
+func flatObject(versions map[string]dto.Version) map[string]any {
+	output := make(map[string]any, len(versions))
+	for key, version := range versions {
+		output[key] = version
+	}
+	return output
+}
+
+// versionValues returns the values of versions, the nested output of an export
+func versionValues(versions map[string]dto.Version, err error) (map[string][]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	output := make(map[string][]string, len(versions))
+	for path, version := range versions {
+		output[path] = version.Values
+	}
+	return output, nil
+}
+
+// nodeObject renders node in the node output, the fields of dto.Node which are set
+func nodeObject(node *dto.Node) map[string]any {
+	output := map[string]any{}
+	if len(node.Values) > 0 {
+		output["values"] = node.Values
+	}
+	if node.Meta != nil {
+		output["meta"] = node.Meta
+	}
+	if len(node.Children) > 0 {
+		children := make(map[string]any, len(node.Children))
+		for name, child := range node.Children {
+			children[name] = nodeObject(child)
+		}
+		output["children"] = children
+	}
+	return output
+}
@@ -0,0 +1,556 @@
+package dendrite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/laminatedio/dendrite/internal/pkg/dendrite/dto"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// QueryError is an error in the query or its variables, rather than in fetching the values
+type QueryError struct {
+	Message string
+}
+
+func (err *QueryError) Error() string {
+	return err.Message
+}
+
+func queryErrorf(format string, args ...any) error {
+	return &QueryError{Message: fmt.Sprintf(format, args...)}
+}
+
+// Execute runs the operation of a GraphQL request.
+// Queries return the selected values in the output mode of input, mutations return the metadata of the versions they wrote.
+// There is no schema: every field of a query is a path segment, and type conditions of fragments are not checked.
+// Leaves take either a version argument or an at argument, an RFC3339 timestamp selecting the version which was current then.
+// The reserved _meta sub-selection of a leaf returns the version read, the latest version and the time of the last write.
+// A query with a revision reads the leaves without a version or at argument as they were after the write of that revision.
+func (s *DendriteService) Execute(ctx context.Context, input dto.QueryInput) (map[string]any, error) {
+	object, _, err := s.ExecuteWithRevision(ctx, input)
+	return object, err
+}
+
+// ExecuteWithRevision is Execute, also returning the global revision of the result: the revision a query read at,
+// or the revision written by a mutation. It is -1 when the backend does not support revisions or nothing was written.
+func (s *DendriteService) ExecuteWithRevision(ctx context.Context, input dto.QueryInput) (map[string]any, int, error) {
+	operation, err := parseOperation(input)
+	if err != nil {
+		return nil, -1, err
+	}
+	variables, err := coerceVariables(operation.VariableDefinitions, input.Variables)
+	if err != nil {
+		return nil, -1, err
+	}
+	options, err := getQueryOptions(input)
+	if err != nil {
+		return nil, -1, err
+	}
+	return s.execute(ctx, operation, variables, options)
+}
+
+// queryOptions are the options of a request which apply to queries
+type queryOptions struct {
+	// revision reads the leaves without a version or at argument at that global revision, when it is not nil
+	revision *int
+	output   dto.OutputMode
+}
+
+func getQueryOptions(input dto.QueryInput) (queryOptions, error) {
+	output, err := parseOutputMode(input.Output)
+	if err != nil {
+		return queryOptions{}, err
+	}
+	return queryOptions{revision: input.Revision, output: output}, nil
+}
+
+func (s *DendriteService) execute(ctx context.Context, operation *ast.OperationDefinition, variables map[string]any, options queryOptions) (map[string]any, int, error) {
+	if options.revision != nil && operation.Operation != ast.Query {
+		return nil, -1, queryErrorf("a revision can only be given for queries")
+	}
+	switch operation.Operation {
+	case ast.Query:
+		if revision := options.revision; revision != nil {
+			if err := s.checkRevision(ctx, *revision); err != nil {
+				return nil, -1, err
+			}
+			object, err := s.query(ctx, operation, variables, options)
+			return object, *revision, err
+		}
+		// the revision is read first, so the values read are at least as new as it
+		latest, err := s.backend.Revision(ctx)
+		if err != nil {
+			latest = -1
+		}
+		object, err := s.query(ctx, operation, variables, options)
+		return object, latest, err
+	case ast.Mutation:
+		return s.mutate(ctx, operation, variables)
+	case ast.Subscription:
+		return nil, -1, queryErrorf("subscriptions must be sent over a WebSocket with the %s protocol", graphqlTransportWS)
+	}
+	return nil, -1, queryErrorf("%s operations are not supported", operation.Operation)
+}
+
+// parseOperation parses the document of input and returns the operation to run, with its fragment spreads resolved
+func parseOperation(input dto.QueryInput) (*ast.OperationDefinition, error) {
+	document, err := parser.ParseQuery(&ast.Source{Input: input.Query})
+	if err != nil {
+		return nil, &QueryError{Message: err.Error()}
+	}
+	operation, err := getOperation(document, input.OperationName)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveFragments(document); err != nil {
+		return nil, err
+	}
+	return operation, nil
+}
+
+// query returns the values selected by operation in the output mode of options
+func (s *DendriteService) query(ctx context.Context, operation *ast.OperationDefinition, variables map[string]any, options queryOptions) (map[string]any, error) {
+	fields, err := collectFields(operation.SelectionSet, variables)
+	if err != nil {
+		return nil, err
+	}
+	// introspection fields are resolved against the schema, every other field selects config
+	introspected := map[string]any{}
+	var introspector *introspection
+	selections := []dto.Selection{}
+	for _, field := range fields {
+		switch field.Name {
+		case "__schema", "__type":
+			if introspector == nil {
+				schema, err := s.Schema(ctx)
+				if err != nil {
+					return nil, err
+				}
+				introspector = &introspection{schema: schema, variables: variables}
+			}
+			value, err := introspector.root(field)
+			if err != nil {
+				return nil, err
+			}
+			introspected[responseKey(field)] = value
+		case "__typename":
+			introspected[responseKey(field)] = "Query"
+		default:
+			result, err := s.GetSelectionsByField(field, "", "", variables)
+			if err != nil {
+				return nil, err
+			}
+			selections = append(selections, result...)
+		}
+	}
+	selections, err = mergeSelections(selections)
+	if err != nil {
+		return nil, err
+	}
+	if options.revision != nil {
+		for i := range selections {
+			if selections[i].Version == -1 && selections[i].At == nil {
+				selections[i].Revision = options.revision
+			}
+		}
+	}
+	if len(introspected) > 0 && options.output != dto.OutputNested {
+		return nil, queryErrorf("introspection fields are only supported by the %s output", dto.OutputNested)
+	}
+	for _, selection := range selections {
+		key := strings.Split(selection.Key, "/")[1]
+		if _, ok := introspected[key]; ok {
+			return nil, queryErrorf("%s selects both config and an introspection field", key)
+		}
+	}
+	if options.output == dto.OutputFlat {
+		versions, err := s.GetVersionsByPaths(ctx, selections)
+		if err != nil {
+			return nil, err
+		}
+		return flatObject(versions), nil
+	}
+	node, err := s.GetNodeByPaths(ctx, selections)
+	if err != nil {
+		return nil, err
+	}
+	if options.output == dto.OutputNode {
+		return nodeObject(node), nil
+	}
+	object, err := nestedObject(node, "/")
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range introspected {
+		object[key] = value
+	}
+	return object, nil
+}
+
+// getOperation returns the operation called name, which may be omitted when the document has a single operation
+func getOperation(document *ast.QueryDocument, name string) (*ast.OperationDefinition, error) {
+	if name == "" {
+		if len(document.Operations) != 1 {
+			return nil, queryErrorf("operationName is required, the document contains %d operations", len(document.Operations))
+		}
+		return document.Operations[0], nil
+	}
+	operation := document.Operations.ForName(name)
+	if operation == nil {
+		return nil, queryErrorf("unknown operation %s", name)
+	}
+	return operation, nil
+}
+
+// resolveFragments links every fragment spread of document to its definition, rejecting unknown and cyclic fragments
+func resolveFragments(document *ast.QueryDocument) error {
+	const visiting, visited = 1, 2
+	state := map[string]int{}
+	var visit func(set ast.SelectionSet) error
+	visitFragment := func(fragment *ast.FragmentDefinition) error {
+		switch state[fragment.Name] {
+		case visiting:
+			return queryErrorf("fragment %s spreads itself", fragment.Name)
+		case visited:
+			return nil
+		}
+		state[fragment.Name] = visiting
+		if err := visit(fragment.SelectionSet); err != nil {
+			return err
+		}
+		state[fragment.Name] = visited
+		return nil
+	}
+	visit = func(set ast.SelectionSet) error {
+		for _, selection := range set {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				if err := visit(selection.SelectionSet); err != nil {
+					return err
+				}
+			case *ast.InlineFragment:
+				if err := visit(selection.SelectionSet); err != nil {
+					return err
+				}
+			case *ast.FragmentSpread:
+				fragment := document.Fragments.ForName(selection.Name)
+				if fragment == nil {
+					return queryErrorf("unknown fragment %s", selection.Name)
+				}
+				selection.Definition = fragment
+				if err := visitFragment(fragment); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, operation := range document.Operations {
+		if err := visit(operation.SelectionSet); err != nil {
+			return err
+		}
+	}
+	for _, fragment := range document.Fragments {
+		if err := visitFragment(fragment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// coerceVariables returns the value of every variable defined by the operation, nil when it is neither provided nor defaulted
+func coerceVariables(definitions ast.VariableDefinitionList, input map[string]any) (map[string]any, error) {
+	variables := make(map[string]any, len(definitions))
+	for _, definition := range definitions {
+		value, ok := input[definition.Variable]
+		if !ok && definition.DefaultValue != nil {
+			defaultValue, err := definition.DefaultValue.Value(nil)
+			if err != nil {
+				return nil, queryErrorf("invalid default value of $%s: %v", definition.Variable, err)
+			}
+			value = defaultValue
+		}
+		value, err := coerceValue(value, definition.Type)
+		if err != nil {
+			return nil, queryErrorf("invalid value of $%s: %v", definition.Variable, err)
+		}
+		variables[definition.Variable] = value
+	}
+	return variables, nil
+}
+
+// coerceValue converts a JSON value to the built-in scalar type t, values of other types are kept as they are
+func coerceValue(value any, t *ast.Type) (any, error) {
+	if value == nil {
+		if t.NonNull {
+			return nil, fmt.Errorf("%s is required", t)
+		}
+		return nil, nil
+	}
+	if t.Elem != nil {
+		list, ok := value.([]any)
+		if !ok {
+			list = []any{value}
+		}
+		result := make([]any, len(list))
+		for i, element := range list {
+			coerced, err := coerceValue(element, t.Elem)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = coerced
+		}
+		return result, nil
+	}
+	switch t.NamedType {
+	case "Int":
+		switch value := value.(type) {
+		case int:
+			return value, nil
+		case int64:
+			return int(value), nil
+		case float64:
+			if value == math.Trunc(value) && value >= math.MinInt32 && value <= math.MaxInt32 {
+				return int(value), nil
+			}
+		case json.Number:
+			if result, err := value.Int64(); err == nil {
+				return int(result), nil
+			}
+		}
+	case "Float":
+		switch value := value.(type) {
+		case float64:
+			return value, nil
+		case int:
+			return float64(value), nil
+		case int64:
+			return float64(value), nil
+		}
+	case "Boolean":
+		if _, ok := value.(bool); ok {
+			return value, nil
+		}
+	case "String", "ID":
+		if _, ok := value.(string); ok {
+			return value, nil
+		}
+	default:
+		return value, nil
+	}
+	return nil, fmt.Errorf("%v is not a %s", value, t.NamedType)
+}
+
+// argumentValue returns the value of the argument called name, nil when it is absent
+func argumentValue(args ast.ArgumentList, name string, variables map[string]any) (any, error) {
+	arg := args.ForName(name)
+	if arg == nil {
+		return nil, nil
+	}
+	if err := checkVariables(arg.Value, variables); err != nil {
+		return nil, err
+	}
+	value, err := arg.Value.Value(variables)
+	if err != nil {
+		return nil, queryErrorf("invalid value of argument %s: %v", name, err)
+	}
+	return value, nil
+}
+
+// checkVariables rejects variables of value which are not defined by the operation
+func checkVariables(value *ast.Value, variables map[string]any) error {
+	if value.Kind == ast.Variable {
+		if _, ok := variables[value.Raw]; !ok {
+			return queryErrorf("variable $%s is not defined", value.Raw)
+		}
+	}
+	for _, child := range value.Children {
+		if err := checkVariables(child.Value, variables); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// included evaluates the @include and @skip directives of a selection
+func included(directives ast.DirectiveList, variables map[string]any) (bool, error) {
+	for _, directive := range directives {
+		if directive.Name != "include" && directive.Name != "skip" {
+			return false, queryErrorf("unknown directive @%s", directive.Name)
+		}
+		value, err := argumentValue(directive.Arguments, "if", variables)
+		if err != nil {
+			return false, err
+		}
+		condition, ok := value.(bool)
+		if !ok {
+			return false, queryErrorf("argument if of @%s must be a Boolean", directive.Name)
+		}
+		if condition == (directive.Name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// collectFields returns the fields of set, inlining its fragments and dropping the selections excluded by directives
+func collectFields(set ast.SelectionSet, variables map[string]any) ([]*ast.Field, error) {
+	output := []*ast.Field{}
+	for _, selection := range set {
+		var directives ast.DirectiveList
+		var inner ast.SelectionSet
+		switch selection := selection.(type) {
+		case *ast.Field:
+			directives = selection.Directives
+		case *ast.FragmentSpread:
+			directives = selection.Directives
+			inner = selection.Definition.SelectionSet
+		case *ast.InlineFragment:
+			directives = selection.Directives
+			inner = selection.SelectionSet
+		}
+		ok, err := included(directives, variables)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if field, isField := selection.(*ast.Field); isField {
+			output = append(output, field)
+			continue
+		}
+		fields, err := collectFields(inner, variables)
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, fields...)
+	}
+	return output, nil
+}
+
+// mergeSelections drops repeated selections of the same leaf, and rejects different fields under the same response key
+func mergeSelections(selections []dto.Selection) ([]dto.Selection, error) {
+	// every prefix of a key is the response key of a field, which must always select the same path
+	fields := map[string]string{}
+	values, metaLeaves := &keySet{}, &keySet{}
+	seen := map[string]int{}
+	output := []dto.Selection{}
+	for _, selection := range selections {
+		keys, paths := strings.Split(selection.Key, "/"), strings.Split(selection.Path, "/")
+		// the key of a _meta selection has one more segment than its path
+		for i := 2; i <= len(keys) && i <= len(paths); i++ {
+			key, path := strings.Join(keys[:i], "/"), strings.Join(paths[:i], "/")
+			if previous, ok := fields[key]; ok && previous != path {
+				return nil, queryErrorf("%s selects both %s and %s", key, previous, path)
+			}
+			fields[key] = path
+		}
+		if err := checkMetaLeaves(selection, keys, values, metaLeaves); err != nil {
+			return nil, err
+		}
+
+		if i, ok := seen[selection.Key]; ok {
+			previous := &output[i]
+			if previous.Version != selection.Version {
+				return nil, queryErrorf("%s selects both version %d and version %d of %s", selection.Key, previous.Version, selection.Version, selection.Path)
+			}
+			if (previous.At == nil) != (selection.At == nil) || (previous.At != nil && !previous.At.Equal(*selection.At)) {
+				return nil, queryErrorf("%s selects %s at different times", selection.Key, selection.Path)
+			}
+			meta, err := mergeMetaFields(selection.Key, previous.Meta, selection.Meta)
+			if err != nil {
+				return nil, err
+			}
+			previous.Meta = meta
+			continue
+		}
+		seen[selection.Key] = len(output)
+		output = append(output, selection)
+	}
+	return output, nil
+}
+
+// keySet holds the keys of selections, and every strict prefix of them
+type keySet struct {
+	keys     map[string]bool
+	prefixes map[string]bool
+}
+
+func (set *keySet) add(keys []string) {
+	if set.keys == nil {
+		set.keys, set.prefixes = map[string]bool{}, map[string]bool{}
+	}
+	for i := 2; i < len(keys); i++ {
+		set.prefixes[strings.Join(keys[:i], "/")] = true
+	}
+	set.keys[strings.Join(keys, "/")] = true
+}
+
+// overlaps reports whether keys, or one of their strict prefixes, is a key or a strict prefix of set
+func (set *keySet) overlaps(keys []string) bool {
+	key := strings.Join(keys, "/")
+	if set.keys[key] || set.prefixes[key] {
+		return true
+	}
+	for i := 2; i < len(keys); i++ {
+		if set.keys[strings.Join(keys[:i], "/")] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMetaLeaves rejects selections of values or fields on a leaf selecting _meta, and _meta below a value
+func checkMetaLeaves(selection dto.Selection, keys []string, values *keySet, metaLeaves *keySet) error {
+	if selection.Meta == nil {
+		if metaLeaves.overlaps(keys) {
+			return queryErrorf("%s selects both a value and _meta", selection.Key)
+		}
+		values.add(keys)
+		return nil
+	}
+	// the leaf is the parent of the _meta key
+	leaf := keys[:len(keys)-1]
+	if values.overlaps(leaf) {
+		return queryErrorf("%s selects both a value and _meta", strings.Join(leaf, "/"))
+	}
+	if !metaLeaves.keys[strings.Join(leaf, "/")] && metaLeaves.overlaps(leaf) {
+		return queryErrorf("%s selects both fields and _meta", strings.Join(leaf, "/"))
+	}
+	metaLeaves.add(leaf)
+	return nil
+}
+
+// mergeMetaFields merges the fields of two _meta selections placed at the same key
+func mergeMetaFields(key string, fields []dto.MetaField, other []dto.MetaField) ([]dto.MetaField, error) {
+	names := map[string]string{}
+	for _, field := range fields {
+		names[field.Key] = field.Name
+	}
+	for _, field := range other {
+		name, ok := names[field.Key]
+		if ok && name != field.Name {
+			return nil, queryErrorf("%s/%s selects both %s and %s", key, field.Key, name, field.Name)
+		}
+		if !ok {
+			names[field.Key] = field.Name
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// responseKey returns the name of field in the result, its alias when it has one
+func responseKey(field *ast.Field) string {
+	if field.Alias != "" {
+		return field.Alias
+	}
+	return field.Name
+}
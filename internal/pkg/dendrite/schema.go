@@ -0,0 +1,166 @@
+package dendrite
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+// mutationSchema declares the mutations, which do not depend on the stored paths
+const mutationSchema = `
+"Metadata of a path after a write"
+type Metadata {
+	path: String!
+	latestVersion: Int!
+	currentVersion: Int!
+	createdAt: String!
+	updatedAt: String!
+	"Global revision of the write, shared by every write of a mutation"
+	revision: Int!
+}
+
+"All writes of a mutation are applied at once, or not at all"
+type Mutation {
+	"Writes value as a new version of path, failing when expectedVersion is set and is not the latest version (0 for a new path)"
+	set(path: String!, value: String!, keepCurrent: Boolean = false, expectedVersion: Int): Metadata!
+	"Writes values as a new version of path, failing when expectedVersion is set and is not the latest version (0 for a new path)"
+	setMany(path: String!, values: [String!]!, keepCurrent: Boolean = false, expectedVersion: Int): Metadata!
+}
+`
+
+// prelude holds the built-in scalars, directives and introspection types, along with the mutations, every schema starts with
+var prelude = func() *ast.Schema {
+	schema, err := validator.LoadSchema(validator.Prelude, &ast.Source{Name: "mutation.graphql", Input: mutationSchema, BuiltIn: true})
+	if err != nil {
+		panic(fmt.Sprintf("failed to load the GraphQL prelude: %v", err))
+	}
+	return schema
+}()
+
+// fieldName matches the path segments usable as GraphQL field names, other segments are left out of the schema
+var fieldName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// schemaNode is a segment of the path tree
+type schemaNode struct {
+	path     string
+	children map[string]*schemaNode
+	// multiple is set on leaves whose current version has more than one value
+	multiple bool
+}
+
+// Schema generates the GraphQL schema of the paths stored in the backend.
+// Paths with children are objects, every other path is a String leaf, or [String!] when its current version
+// has more than one value, taking version and at arguments. The _meta sub-selection of leaves is not part of the schema. Values stored at paths which have children are not part of the schema.
+func (s *DendriteService) Schema(ctx context.Context) (*ast.Schema, error) {
+	list, err := s.backend.List(ctx, "/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list paths: %w", err)
+	}
+	root := &schemaNode{children: map[string]*schemaNode{}}
+	nodes := map[string]*schemaNode{}
+	for _, metadata := range list {
+		node := root
+		for _, segment := range strings.Split(metadata.Path, "/")[1:] {
+			// _meta is reserved for the metadata of leaves
+			if !fieldName.MatchString(segment) || strings.HasPrefix(segment, "__") || segment == metaField {
+				node = nil
+				break
+			}
+			child, ok := node.children[segment]
+			if !ok {
+				child = &schemaNode{path: node.path + "/" + segment, children: map[string]*schemaNode{}}
+				node.children[segment] = child
+			}
+			node = child
+		}
+		if node != nil && node != root {
+			nodes[node.path] = node
+		}
+	}
+
+	// the values decide between String and [String!], so the current values of every leaf are fetched at once
+	selections := []backend.Selection{}
+	for path, node := range nodes {
+		if len(node.children) == 0 {
+			selections = append(selections, backend.Selection{Path: path, Version: -1})
+		}
+	}
+	values, err := s.backend.GetManyPaths(ctx, selections)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get values: %w", err)
+	}
+	for i, selection := range selections {
+		nodes[selection.Path].multiple = len(values[i]) > 1
+	}
+
+	schema := &ast.Schema{
+		Types:         map[string]*ast.Definition{},
+		Directives:    prelude.Directives,
+		PossibleTypes: prelude.PossibleTypes,
+		Implements:    prelude.Implements,
+	}
+	for name, definition := range prelude.Types {
+		schema.Types[name] = definition
+	}
+	// subscriptions select the same fields as queries, the name is taken before the path types are named
+	subscription := &ast.Definition{Kind: ast.Object, Name: "Subscription", Description: "Selected values are sent again whenever they change"}
+	schema.Types[subscription.Name] = subscription
+	schema.Query = addObjectType(schema, root, "Query")
+	subscription.Fields = schema.Query.Fields
+	schema.Mutation = prelude.Types["Mutation"]
+	schema.Subscription = subscription
+	return schema, nil
+}
+
+// addObjectType adds the object type of node and its children to schema, named after name, or after name with a number when it is taken
+func addObjectType(schema *ast.Schema, node *schemaNode, name string) *ast.Definition {
+	unique := name
+	for i := 2; schema.Types[unique] != nil; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	definition := &ast.Definition{
+		Kind:        ast.Object,
+		Name:        unique,
+		Description: "Config below " + node.path + "/",
+	}
+	schema.Types[unique] = definition
+
+	segments := make([]string, 0, len(node.children))
+	for segment := range node.children {
+		segments = append(segments, segment)
+	}
+	sort.Strings(segments)
+	for _, segment := range segments {
+		child := node.children[segment]
+		field := &ast.FieldDefinition{
+			Name:        segment,
+			Description: child.path,
+		}
+		if len(child.children) > 0 {
+			field.Type = ast.NamedType(addObjectType(schema, child, strings.Join(strings.Split(child.path, "/")[1:], "_")).Name, nil)
+		} else {
+			field.Arguments = ast.ArgumentDefinitionList{{
+				Name:        "version",
+				Description: "Version to read, the current version when omitted",
+				Type:        ast.NamedType("Int", nil),
+			}, {
+				Name:        "at",
+				Description: "RFC3339 timestamp, reads the version which was current at that time instead of version",
+				Type:        ast.NamedType("String", nil),
+			}}
+			field.Type = ast.NamedType("String", nil)
+			if child.multiple {
+				field.Type = ast.ListType(ast.NonNullNamedType("String", nil), nil)
+			}
+		}
+		definition.Fields = append(definition.Fields, field)
+	}
+	return definition
+}
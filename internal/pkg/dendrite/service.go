@@ -6,12 +6,12 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/laminatedio/dendrite/internal/pkg/backend"
 	"github.com/laminatedio/dendrite/internal/pkg/dendrite/dto"
 
-	"github.com/tmc/graphql"
-	"github.com/tmc/graphql/parser"
+	"github.com/vektah/gqlparser/v2/ast"
 )
 
 type DendriteService struct {
@@ -25,121 +25,442 @@ func NewDendriteService(backend backend.Backend) *DendriteService {
 }
 
 // -1: version not found --> current
-func (s *DendriteService) GetFieldVersion(args []graphql.Argument) (int, error) {
-	for _, arg := range args {
-		if arg.Name == "version" {
-			switch arg.Value.(type) {
-			case int:
-				return arg.Value.(int), nil
-			default:
-				return 0, errors.New("invalid version provided")
-			}
-		}
+func (s *DendriteService) GetFieldVersion(args ast.ArgumentList, variables map[string]any) (int, error) {
+	value, err := argumentValue(args, "version", variables)
+	if err != nil {
+		return 0, err
+	}
+	switch value := value.(type) {
+	case nil:
+		return -1, nil
+	case int64:
+		return int(value), nil
+	case int:
+		return value, nil
+	default:
+		return 0, queryErrorf("invalid version provided")
+	}
+}
+
+// GetFieldTime returns the time of the at argument, nil when it is absent
+func (s *DendriteService) GetFieldTime(args ast.ArgumentList, variables map[string]any) (*time.Time, error) {
+	value, err := argumentValue(args, "at", variables)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil
 	}
-	return -1, nil
+	text, ok := value.(string)
+	if !ok {
+		return nil, queryErrorf("invalid time provided, expected an RFC3339 timestamp")
+	}
+	at, err := time.Parse(time.RFC3339Nano, text)
+	if err != nil {
+		return nil, queryErrorf("invalid time provided, expected an RFC3339 timestamp: %s", text)
+	}
+	if args.ForName("version") != nil {
+		return nil, queryErrorf("version and at cannot be both provided")
+	}
+	return &at, nil
 }
 
-func (s *DendriteService) GetSelectionsByField(field graphql.Field, base string) ([]dto.Selection, error) {
+// GetSelectionsByField returns the leaves of field below the path base, placed in the result below key
+func (s *DendriteService) GetSelectionsByField(field *ast.Field, base string, key string, variables map[string]any) ([]dto.Selection, error) {
+	base, key = path.Join("/", base, field.Name), path.Join("/", key, responseKey(field))
 	if len(field.SelectionSet) <= 0 {
-		version, err := s.GetFieldVersion(field.Arguments)
+		version, err := s.GetFieldVersion(field.Arguments, variables)
+		if err != nil {
+			return nil, err
+		}
+		at, err := s.GetFieldTime(field.Arguments, variables)
 		if err != nil {
 			return nil, err
 		}
 		return []dto.Selection{{
-			Path:    path.Join(base, field.Name),
+			Path:    base,
 			Version: version,
+			At:      at,
+			Key:     key,
 		}}, nil
-	} else {
-		output := []dto.Selection{}
-		for _, section := range field.SelectionSet {
-			urls, err := s.GetSelectionsByField(*section.Field, fmt.Sprintf("%v/%v", base, field.Name))
-			if err != nil {
-				return nil, err
-			}
-			output = append(output, urls...)
-		}
-		return output, nil
 	}
-}
-
-func (s *DendriteService) GetConfigsBySelection(ctx context.Context, selection dto.Selection) ([]string, error) {
-	if selection.Version == -1 {
-		result, err := s.backend.GetManyCurrent(ctx, selection.Path)
-		if err != nil {
-			return nil, err
+	fields, err := collectFields(field.SelectionSet, variables)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		if f.Name == metaField {
+			return s.getMetaSelections(field, fields, base, key, variables)
 		}
-		return result, nil
-	} else {
-		result, err := s.backend.GetMany(ctx, selection.Path, selection.Version)
+	}
+	output := []dto.Selection{}
+	for _, f := range fields {
+		result, err := s.GetSelectionsByField(f, base, key, variables)
 		if err != nil {
 			return nil, err
 		}
-		return result, nil
+		output = append(output, result...)
 	}
+	return output, nil
 }
 
+// GetObjectByPaths returns the values selected in the nested output
 func (s *DendriteService) GetObjectByPaths(ctx context.Context, selections []dto.Selection) (map[string]any, error) {
-	output := make(map[string]any)
+	node, err := s.GetNodeByPaths(ctx, selections)
+	if err != nil {
+		return nil, err
+	}
+	return nestedObject(node, "/")
+}
+
+// checkPaths returns an error unless every selection has an absolute path
+func checkPaths(selections []dto.Selection) error {
 	for _, selection := range selections {
 		if !strings.HasPrefix(selection.Path, "/") {
-			return nil, errors.New("invalid path")
+			return errors.New("invalid path")
 		}
-		values, err := s.GetConfigsBySelection(ctx, selection)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get values from db: %w", err)
+	}
+	return nil
+}
+
+// GetNodeByPaths returns the root node of the values selected, placed at the keys of the selections.
+// Paths without values, and _meta selections of versions which do not exist, are left out.
+func (s *DendriteService) GetNodeByPaths(ctx context.Context, selections []dto.Selection) (*dto.Node, error) {
+	if err := checkPaths(selections); err != nil {
+		return nil, err
+	}
+	selections, err := s.resolveVersions(ctx, selections)
+	if err != nil {
+		return nil, err
+	}
+	// the metadata of the paths selecting _meta is fetched at once, and their current values are read at the
+	// current version it holds, so that _meta describes exactly the values returned
+	metadata, err := s.getManyMetadata(ctx, selections, func(selection dto.Selection) bool {
+		return selection.Meta != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// all values are fetched at once, rather than a round trip to the backend per selection
+	paths := []backend.Selection{}
+	for _, selection := range selections {
+		if selection.Meta != nil {
+			continue
 		}
-		if len(values) > 0 {
-			var u = output
-			subPaths := strings.Split(selection.Path, "/")[1:]
-			for i, subPath := range subPaths {
-				if i == len(subPaths)-1 {
-					switch u[subPath].(type) {
-					case string:
-						u[subPath] = append(values, u[subPath].(string))
-					case []string:
-						u[subPath] = append(u[subPath].([]string), values...)
-					case map[string]any:
-						if u[subPath].(map[string]any)["/"] != nil {
-							u[subPath].(map[string]any)["/"] = append(u[subPath].(map[string]any)["/"].([]string), values...)
-						} else {
-							u[subPath].(map[string]any)["/"] = values
-						}
-					case nil:
-						if len(values) > 1 {
-							u[subPath] = values
-						} else {
-							u[subPath] = values[0]
-						}
-					}
-				} else {
-					if u[subPath] == nil {
-						u[subPath] = make(map[string]any)
-					}
-					u = u[subPath].(map[string]any)
-				}
+		version := selection.Version
+		if m, ok := metadata[selection.Path]; ok && version == -1 {
+			version = currentVersion(m)
+		}
+		paths = append(paths, backend.Selection{Path: selection.Path, Version: version})
+	}
+	results, err := s.backend.GetManyPaths(ctx, paths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get values from db: %w", err)
+	}
+	root := &dto.Node{}
+	for _, selection := range selections {
+		key := selection.Key
+		if key == "" {
+			key = selection.Path
+		}
+		if selection.Meta != nil {
+			if meta := getMeta(metadata[selection.Path], selection); meta != nil {
+				root.Child(key).Meta = meta
 			}
+			continue
+		}
+		values := results[0]
+		results = results[1:]
+		if len(values) > 0 {
+			node := root.Child(key)
+			node.Values = append(node.Values, values...)
+		}
+	}
+	return root, nil
+}
+
+// getManyMetadata returns the metadata of the paths of the selections matching match, fetched at once.
+// Every such path is in the result, with nil metadata when it does not exist.
+func (s *DendriteService) getManyMetadata(ctx context.Context, selections []dto.Selection, match func(dto.Selection) bool) (map[string]*backend.Metadata, error) {
+	output := map[string]*backend.Metadata{}
+	paths := []string{}
+	for _, selection := range selections {
+		if _, ok := output[selection.Path]; !ok && match(selection) {
+			output[selection.Path] = nil
+			paths = append(paths, selection.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return output, nil
+	}
+	result, err := s.backend.GetManyMetadata(ctx, paths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata: %w", err)
+	}
+	for i, path := range paths {
+		output[path] = result[i]
+	}
+	return output, nil
+}
+
+// currentVersion returns the current version of metadata, 0 which reads as empty when the path does not exist
+func currentVersion(metadata *backend.Metadata) int {
+	if metadata == nil {
+		return 0
+	}
+	return metadata.CurrentVersion
+}
+
+// GetVersionsByPaths returns the version and values of every selection with values in the flat output, keyed by
+// the key of the selection. The current versions are resolved first, so that every version matches its values.
+func (s *DendriteService) GetVersionsByPaths(ctx context.Context, selections []dto.Selection) (map[string]dto.Version, error) {
+	if err := checkPaths(selections); err != nil {
+		return nil, err
+	}
+	for _, selection := range selections {
+		if selection.Meta != nil {
+			return nil, queryErrorf("_meta is not supported by the %s output, which returns the version of every path", dto.OutputFlat)
+		}
+	}
+	selections, err := s.resolveVersions(ctx, selections)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := s.getManyMetadata(ctx, selections, func(selection dto.Selection) bool {
+		return selection.Version == -1
+	})
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]backend.Selection, len(selections))
+	for i, selection := range selections {
+		version := selection.Version
+		if version == -1 {
+			version = currentVersion(metadata[selection.Path])
+		}
+		paths[i] = backend.Selection{Path: selection.Path, Version: version}
+	}
+	results, err := s.backend.GetManyPaths(ctx, paths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get values from db: %w", err)
+	}
+	output := map[string]dto.Version{}
+	for i, selection := range selections {
+		if len(results[i]) == 0 {
+			continue
 		}
+		key := selection.Key
+		if key == "" {
+			key = selection.Path
+		}
+		output[key] = dto.Version{Version: paths[i].Version, Values: results[i]}
+	}
+	return output, nil
+}
 
+// resolveVersions returns a copy of selections where the selections at a time or revision select the version
+// which was current then, the versions at each time and revision are resolved at once
+func (s *DendriteService) resolveVersions(ctx context.Context, selections []dto.Selection) ([]dto.Selection, error) {
+	output := append([]dto.Selection{}, selections...)
+	times := map[time.Time][]int{}
+	revisions := map[int][]int{}
+	for i, selection := range output {
+		if selection.At != nil {
+			at := selection.At.UTC()
+			times[at] = append(times[at], i)
+		} else if selection.Revision != nil {
+			revisions[*selection.Revision] = append(revisions[*selection.Revision], i)
+		}
+	}
+	resolve := func(positions []int, getVersions func(paths []string) ([]int, error)) error {
+		paths := make([]string, len(positions))
+		for j, i := range positions {
+			paths[j] = output[i].Path
+		}
+		versions, err := getVersions(paths)
+		if err != nil {
+			return err
+		}
+		for j, i := range positions {
+			output[i].Version, output[i].At, output[i].Revision = versions[j], nil, nil
+		}
+		return nil
+	}
+	for at, positions := range times {
+		err := resolve(positions, func(paths []string) ([]int, error) {
+			return s.backend.GetVersionsAt(ctx, paths, at)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the versions at %s: %w", at.Format(time.RFC3339Nano), err)
+		}
+	}
+	for revision, positions := range revisions {
+		err := resolve(positions, func(paths []string) ([]int, error) {
+			return s.backend.GetVersionsAtRevision(ctx, paths, revision)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the versions at revision %d: %w", revision, err)
+		}
 	}
 	return output, nil
 }
 
+// Revision returns the latest global revision of the backend
+func (s *DendriteService) Revision(ctx context.Context) (int, error) {
+	return s.backend.Revision(ctx)
+}
+
+// checkRevision returns a QueryError unless revision has been written
+func (s *DendriteService) checkRevision(ctx context.Context, revision int) error {
+	latest, err := s.backend.Revision(ctx)
+	if errors.Is(err, backend.ErrRevisionsUnsupported) {
+		return &QueryError{Message: err.Error()}
+	} else if err != nil {
+		return fmt.Errorf("failed to get the latest revision: %w", err)
+	}
+	if revision < 0 || revision > latest {
+		return queryErrorf("revision %d does not exist, the latest revision is %d", revision, latest)
+	}
+	return nil
+}
+
 func (s *DendriteService) Query(ctx context.Context, query string) (map[string]any, error) {
-	operation, err := parser.ParseOperation([]byte(query))
+	return s.Execute(ctx, dto.QueryInput{Query: query})
+}
+
+func (s *DendriteService) History(ctx context.Context, path string) (*dto.History, error) {
+	metadata, err := s.backend.GetMetadata(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	history := &dto.History{
+		Metadata: *metadata,
+		Versions: []dto.Version{},
+	}
+	for version := metadata.LatestVersion; version > 0; version-- {
+		values, err := s.backend.GetMany(ctx, path, version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get version %d: %w", version, err)
+		}
+		history.Versions = append(history.Versions, dto.Version{
+			Version: version,
+			Values:  values,
+		})
+	}
+	return history, nil
+}
+
+// GetManyAt returns the values of the version of path which was current at the given time,
+// which are empty when the path had no current version then
+func (s *DendriteService) GetManyAt(ctx context.Context, path string, at time.Time) ([]string, error) {
+	versions, err := s.backend.GetVersionsAt(ctx, []string{path}, at)
 	if err != nil {
 		return nil, err
 	}
-	selections := []dto.Selection{}
-	for _, section := range operation.SelectionSet {
-		output, err := s.GetSelectionsByField(*section.Field, "/")
+	return s.backend.GetMany(ctx, path, versions[0])
+}
+
+// GetCurrentVersion returns the current version of path along with its values, or the version which was current
+// at asOf when it is not nil. The version is 0 without values when there is none.
+func (s *DendriteService) GetCurrentVersion(ctx context.Context, path string, asOf *time.Time) (dto.Version, error) {
+	version := 0
+	if asOf != nil {
+		versions, err := s.backend.GetVersionsAt(ctx, []string{path}, *asOf)
 		if err != nil {
+			return dto.Version{}, err
+		}
+		version = versions[0]
+	} else {
+		metadata, err := s.backend.GetMetadata(ctx, path)
+		var notFoundErr *backend.NotFoundErr
+		if errors.As(err, &notFoundErr) {
+			return dto.Version{Values: []string{}}, nil
+		} else if err != nil {
+			return dto.Version{}, err
+		}
+		version = metadata.CurrentVersion
+	}
+	values, err := s.backend.GetMany(ctx, path, version)
+	if err != nil {
+		return dto.Version{}, err
+	}
+	return dto.Version{Version: version, Values: values}, nil
+}
+
+// ExportAt returns the values of the prefix and every path below it which were current at the given time.
+// Paths which have been deleted since are not exported.
+func (s *DendriteService) ExportAt(ctx context.Context, prefix string, at time.Time) (map[string][]string, error) {
+	return versionValues(s.ExportVersions(ctx, dto.ExportInput{Prefix: prefix, AsOf: &at}))
+}
+
+// ExportAtRevision returns the values of the prefix and every path below it which were current after the write of revision,
+// a consistent snapshot of the tree. Paths which have been deleted since are not exported.
+func (s *DendriteService) ExportAtRevision(ctx context.Context, prefix string, revision int) (map[string][]string, error) {
+	return versionValues(s.ExportVersions(ctx, dto.ExportInput{Prefix: prefix, Revision: &revision}))
+}
+
+// ExportVersions returns the version and values of the prefix and every path below it with values: the current
+// versions, or the versions which were current at input.AsOf or after the write of input.Revision
+func (s *DendriteService) ExportVersions(ctx context.Context, input dto.ExportInput) (map[string]dto.Version, error) {
+	switch {
+	case input.AsOf != nil && input.Revision != nil:
+		return nil, queryErrorf("asOf and revision cannot be both provided")
+	case input.AsOf != nil:
+		return s.exportVersions(ctx, input.Prefix, func(paths []string, _ []backend.Metadata) ([]int, error) {
+			return s.backend.GetVersionsAt(ctx, paths, *input.AsOf)
+		})
+	case input.Revision != nil:
+		if err := s.checkRevision(ctx, *input.Revision); err != nil {
 			return nil, err
 		}
-		selections = append(selections, output...)
+		return s.exportVersions(ctx, input.Prefix, func(paths []string, _ []backend.Metadata) ([]int, error) {
+			return s.backend.GetVersionsAtRevision(ctx, paths, *input.Revision)
+		})
+	}
+	return s.exportVersions(ctx, input.Prefix, func(_ []string, list []backend.Metadata) ([]int, error) {
+		versions := make([]int, len(list))
+		for i, metadata := range list {
+			versions[i] = metadata.CurrentVersion
+		}
+		return versions, nil
+	})
+}
+
+// exportVersions returns the values of the versions returned by getVersions for the prefix and every path below it
+func (s *DendriteService) exportVersions(ctx context.Context, prefix string, getVersions func(paths []string, list []backend.Metadata) ([]int, error)) (map[string]dto.Version, error) {
+	if !strings.HasPrefix(prefix, "/") {
+		return nil, errors.New("invalid path")
+	}
+	list, err := s.backend.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(list))
+	for i, metadata := range list {
+		paths[i] = metadata.Path
 	}
-	object, err := s.GetObjectByPaths(ctx, selections)
+	versions, err := getVersions(paths, list)
 	if err != nil {
 		return nil, err
 	}
-	return object, nil
+	selections := make([]backend.Selection, len(paths))
+	for i, path := range paths {
+		selections[i] = backend.Selection{Path: path, Version: versions[i]}
+	}
+	results, err := s.backend.GetManyPaths(ctx, selections)
+	if err != nil {
+		return nil, err
+	}
+	output := make(map[string]dto.Version)
+	for i, path := range paths {
+		if len(results[i]) > 0 {
+			output[path] = dto.Version{Version: versions[i], Values: results[i]}
+		}
+	}
+	return output, nil
+}
+
+// Export returns the current values of the prefix and every path below it
+func (s *DendriteService) Export(ctx context.Context, prefix string) (map[string][]string, error) {
+	return versionValues(s.ExportVersions(ctx, dto.ExportInput{Prefix: prefix}))
 }
@@ -2,16 +2,25 @@ package dendrite
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net/http/httptest"
 	"os"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/laminatedio/dendrite/internal/pkg/backend"
 	"github.com/laminatedio/dendrite/internal/pkg/dendrite/dto"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	backendmock "github.com/laminatedio/dendrite/mocks/internal_/pkg/backend"
-	"github.com/tmc/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"go.uber.org/zap"
 )
 
 type Config struct {
@@ -112,22 +121,34 @@ func TestDendriteService_Query(t *testing.T) {
 							D
 						}
 					}
-					A {
-						B
-					}
 				}`,
 			},
 			want: map[string]any{
 				"A": map[string]any{
-					"B": map[string]any{
-						"C": "1",
-						"D": "2",
-						"/": []string{"C", "D"},
-					},
+					"B": map[string]any{"C": "1", "D": "2"},
 				},
 			},
 			wantErr: false,
 		},
+		{
+			name:    "should reject a leaf which is also a parent",
+			configs: testConfig,
+			args: args{
+				ctx: context.Background(),
+				query: `{
+					A {
+						B {
+							C
+						}
+					}
+					A {
+						B
+					}
+				}`,
+			},
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name:    "should get data by query (with one level)",
 			configs: testConfig,
@@ -232,7 +253,8 @@ func TestDendriteService_Query(t *testing.T) {
 
 func TestDendriteService_GetFieldVersion(t *testing.T) {
 	type args struct {
-		args []graphql.Argument
+		args      ast.ArgumentList
+		variables map[string]any
 	}
 	tests := []struct {
 		name        string
@@ -245,10 +267,10 @@ func TestDendriteService_GetFieldVersion(t *testing.T) {
 		{
 			name: "should get version in args",
 			args: args{
-				args: []graphql.Argument{
+				args: ast.ArgumentList{
 					{
 						Name:  "version",
-						Value: 1,
+						Value: &ast.Value{Kind: ast.IntValue, Raw: "1"},
 					},
 				},
 			},
@@ -258,10 +280,10 @@ func TestDendriteService_GetFieldVersion(t *testing.T) {
 		{
 			name: "should get invalid version error",
 			args: args{
-				args: []graphql.Argument{
+				args: ast.ArgumentList{
 					{
 						Name:  "version",
-						Value: "invalid",
+						Value: &ast.Value{Kind: ast.StringValue, Raw: "invalid"},
 					},
 				},
 			},
@@ -271,16 +293,43 @@ func TestDendriteService_GetFieldVersion(t *testing.T) {
 		{
 			name: "should get not found version -1",
 			args: args{
-				args: []graphql.Argument{},
+				args: ast.ArgumentList{},
 			},
 			want:    -1,
 			wantErr: false,
 		},
+		{
+			name: "should get version from variables",
+			args: args{
+				args: ast.ArgumentList{
+					{
+						Name:  "version",
+						Value: &ast.Value{Kind: ast.Variable, Raw: "v"},
+					},
+				},
+				variables: map[string]any{"v": 2},
+			},
+			want:    2,
+			wantErr: false,
+		},
+		{
+			name: "should get undefined variable error",
+			args: args{
+				args: ast.ArgumentList{
+					{
+						Name:  "version",
+						Value: &ast.Value{Kind: ast.Variable, Raw: "v"},
+					},
+				},
+			},
+			want:    0,
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := mockS.GetFieldVersion(tt.args.args)
+			got, err := mockS.GetFieldVersion(tt.args.args, tt.args.variables)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DendriteService.GetFieldVersion() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -294,7 +343,7 @@ func TestDendriteService_GetFieldVersion(t *testing.T) {
 
 func TestDendriteService_GetSelectionsByField(t *testing.T) {
 	type args struct {
-		field graphql.Field
+		field *ast.Field
 		base  string
 	}
 	tests := []struct {
@@ -307,41 +356,33 @@ func TestDendriteService_GetSelectionsByField(t *testing.T) {
 		{
 			name: "should get the selections by field",
 			args: args{
-				field: graphql.Field{
+				field: &ast.Field{
 					Name: "A",
-					SelectionSet: graphql.SelectionSet{
-						{
-							Field: &graphql.Field{
-								Name: "B",
-								Arguments: graphql.Arguments{
-									{
-										Name:  "version",
-										Value: 1,
-									},
+					SelectionSet: ast.SelectionSet{
+						&ast.Field{
+							Name: "B",
+							Arguments: ast.ArgumentList{
+								{
+									Name:  "version",
+									Value: &ast.Value{Kind: ast.IntValue, Raw: "1"},
 								},
 							},
 						},
-						{
-							Field: &graphql.Field{
-								Name: "C",
-								SelectionSet: graphql.SelectionSet{
-									{
-										Field: &graphql.Field{
-											Name: "D",
-											Arguments: graphql.Arguments{
-												{
-													Name:  "version",
-													Value: 2,
-												},
-											},
-										},
-									},
-									{
-										Field: &graphql.Field{
-											Name: "E",
+						&ast.Field{
+							Name: "C",
+							SelectionSet: ast.SelectionSet{
+								&ast.Field{
+									Name: "D",
+									Arguments: ast.ArgumentList{
+										{
+											Name:  "version",
+											Value: &ast.Value{Kind: ast.IntValue, Raw: "2"},
 										},
 									},
 								},
+								&ast.Field{
+									Name: "E",
+								},
 							},
 						},
 					},
@@ -351,26 +392,51 @@ func TestDendriteService_GetSelectionsByField(t *testing.T) {
 				{
 					Path:    "/A/B",
 					Version: 1,
+					Key:     "/A/B",
 				},
 				{
 					Path:    "/A/C/D",
 					Version: 2,
+					Key:     "/A/C/D",
 				},
 				{
 					Path:    "/A/C/E",
 					Version: -1,
+					Key:     "/A/C/E",
+				},
+			},
+		},
+		{
+			name: "should place aliased fields under their alias",
+			args: args{
+				field: &ast.Field{
+					Alias: "X",
+					Name:  "A",
+					SelectionSet: ast.SelectionSet{
+						&ast.Field{
+							Alias: "Y",
+							Name:  "B",
+						},
+					},
+				},
+			},
+			want: []dto.Selection{
+				{
+					Path:    "/A/B",
+					Version: -1,
+					Key:     "/X/Y",
 				},
 			},
 		},
 		{
 			name: "should return error (invalid version)",
 			args: args{
-				field: graphql.Field{
+				field: &ast.Field{
 					Name: "A",
-					Arguments: graphql.Arguments{
+					Arguments: ast.ArgumentList{
 						{
 							Name:  "version",
-							Value: "testing",
+							Value: &ast.Value{Kind: ast.StringValue, Raw: "testing"},
 						},
 					},
 				},
@@ -381,7 +447,7 @@ func TestDendriteService_GetSelectionsByField(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := mockS.GetSelectionsByField(tt.args.field, tt.args.base)
+			got, err := mockS.GetSelectionsByField(tt.args.field, tt.args.base, tt.args.base, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DendriteService.GetSelectionsByField() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -398,9 +464,11 @@ func TestDendriteService_GetObjectByPaths(t *testing.T) {
 		ctx        context.Context
 		selections []dto.Selection
 	}
-	mock.On("GetMany", context.Background(), "/A/B/C", 1).Return([]string{"1", "2"}, nil)
-	mock.On("GetMany", context.Background(), "/A/B/D", 2).Return([]string{"3"}, nil)
-	mock.On("GetManyCurrent", context.Background(), "/A/B").Return([]string{"C", "D"}, nil)
+	mock.On("GetManyPaths", context.Background(), []backend.Selection{
+		{Path: "/A/B/C", Version: 1},
+		{Path: "/A/B/D", Version: 2},
+		{Path: "/A/B", Version: -1},
+	}).Return([][]string{{"1", "2"}, {"3"}, {"C", "D"}}, nil).Once()
 	ctx := context.Background()
 	tests := []struct {
 		name    string
@@ -409,7 +477,7 @@ func TestDendriteService_GetObjectByPaths(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "should return the desired object",
+			name: "should reject a path which has both values and children",
 			args: args{
 				ctx: ctx,
 				selections: []dto.Selection{
@@ -427,16 +495,8 @@ func TestDendriteService_GetObjectByPaths(t *testing.T) {
 					},
 				},
 			},
-			want: map[string]any{
-				"A": map[string]any{
-					"B": map[string]any{
-						`/`: []string{"C", "D"},
-						"C": []string{"1", "2"},
-						"D": "3",
-					},
-				},
-			},
-			wantErr: false,
+			want:    nil,
+			wantErr: true,
 		},
 		{
 			name: "want err :invalid path",
@@ -466,4 +526,1015 @@ func TestDendriteService_GetObjectByPaths(t *testing.T) {
 			}
 		})
 	}
+
+	memory := backend.NewMemoryBackend()
+	memory.Set(ctx, "/X/Y", "1", backend.SetOptions{})
+	memory.Set(ctx, "/X/Y", "2", backend.SetOptions{})
+	memory.Set(ctx, "/X/Y/Z", "3", backend.SetOptions{})
+	s := NewDendriteService(memory)
+	for _, tt := range []struct {
+		name       string
+		selections []dto.Selection
+		want       map[string]any
+	}{
+		{
+			name:       "should merge the values of string leaves in the order of the selections",
+			selections: []dto.Selection{{Path: "/X/Y", Version: 1}, {Path: "/X/Y", Version: 2}},
+			want:       map[string]any{"X": map[string]any{"Y": []string{"1", "2"}}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.GetObjectByPaths(ctx, tt.selections)
+			if err != nil {
+				t.Fatalf("DendriteService.GetObjectByPaths() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DendriteService.GetObjectByPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDendriteService_GetNodeByPaths(t *testing.T) {
+	ctx := context.Background()
+	memory := backend.NewMemoryBackend()
+	memory.Set(ctx, "/X/Y", "1", backend.SetOptions{})
+	memory.Set(ctx, "/X/Y", "2", backend.SetOptions{})
+	memory.Set(ctx, "/X/Y/Z", "3", backend.SetOptions{})
+	s := NewDendriteService(memory)
+
+	t.Run("should merge the values of a leaf which is also a parent in the order of the selections", func(t *testing.T) {
+		got, err := s.GetNodeByPaths(ctx, []dto.Selection{{Path: "/X/Y", Version: 1}, {Path: "/X/Y/Z", Version: -1}, {Path: "/X/Y", Version: 2}})
+		want := &dto.Node{Children: map[string]*dto.Node{
+			"X": {Children: map[string]*dto.Node{
+				"Y": {Values: []string{"1", "2"}, Children: map[string]*dto.Node{"Z": {Values: []string{"3"}}}},
+			}},
+		}}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.GetNodeByPaths() = %#v, %v, want %#v", got, err, want)
+		}
+	})
+}
+
+func TestDendriteService_History(t *testing.T) {
+	ctx := context.Background()
+	mock.On("GetMetadata", ctx, "/H").Return(&backend.Metadata{Path: "/H", LatestVersion: 2, CurrentVersion: 1}, nil)
+	mock.On("GetMany", ctx, "/H", 2).Return([]string{"b"}, nil)
+	mock.On("GetMany", ctx, "/H", 1).Return([]string{"a", "c"}, nil)
+	mock.On("GetMetadata", ctx, "/nonexist").Return(nil, &backend.NotFoundErr{Path: "/nonexist"})
+	tests := []struct {
+		name    string
+		path    string
+		want    *dto.History
+		wantErr bool
+	}{
+		{
+			name: "should return every version from the latest",
+			path: "/H",
+			want: &dto.History{
+				Metadata: backend.Metadata{Path: "/H", LatestVersion: 2, CurrentVersion: 1},
+				Versions: []dto.Version{
+					{Version: 2, Values: []string{"b"}},
+					{Version: 1, Values: []string{"a", "c"}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "want err: path not found",
+			path:    "/nonexist",
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mockS.History(ctx, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DendriteService.History() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DendriteService.History() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDendriteService_Export(t *testing.T) {
+	ctx := context.Background()
+	mock.On("List", ctx, "/X").Return([]backend.Metadata{{Path: "/X", CurrentVersion: 1}, {Path: "/X/Y", CurrentVersion: 2}, {Path: "/X/Z", CurrentVersion: 1}}, nil)
+	mock.On("GetManyPaths", ctx, []backend.Selection{{Path: "/X", Version: 1}, {Path: "/X/Y", Version: 2}, {Path: "/X/Z", Version: 1}}).
+		Return([][]string{{"Y"}, {"1", "2"}, {}}, nil)
+	tests := []struct {
+		name    string
+		prefix  string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{
+			name:   "should return the current values of the subtree",
+			prefix: "/X",
+			want: map[string][]string{
+				"/X":   {"Y"},
+				"/X/Y": {"1", "2"},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "want err: invalid path",
+			prefix:  "X",
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mockS.Export(ctx, tt.prefix)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DendriteService.Export() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DendriteService.Export() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDendriteService_QueryMounts(t *testing.T) {
+	ctx := context.Background()
+	root := backend.NewMemoryBackend()
+	secrets := backend.NewMemoryBackend()
+	router, err := backend.NewRouterBackend([]backend.Mount{
+		{Prefix: "/", Backend: root},
+		{Prefix: "/secrets", Backend: secrets},
+	})
+	if err != nil {
+		t.Fatalf("NewRouterBackend() error = %v", err)
+	}
+	router.Set(ctx, "/A", "1", backend.SetOptions{})
+	router.Set(ctx, "/secrets/B", "2", backend.SetOptions{})
+	s := NewDendriteService(router)
+
+	got, err := s.Query(ctx, `{ A secrets { B } }`)
+	want := map[string]any{"A": "1", "secrets": map[string]any{"B": "2"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("DendriteService.Query() = %#v, %v, want %#v", got, err, want)
+	}
+	if _, err := secrets.GetCurrent(ctx, "/secrets/B"); err != nil {
+		t.Errorf("/secrets/B is not stored in the mounted backend: %v", err)
+	}
+	if _, err := root.GetCurrent(ctx, "/secrets/B"); err == nil {
+		t.Errorf("/secrets/B is stored in the root backend")
+	}
+}
+
+func TestDendriteService_Execute(t *testing.T) {
+	ctx := context.Background()
+	memory := backend.NewMemoryBackend()
+	memory.Set(ctx, "/A/B", "1", backend.SetOptions{})
+	memory.Set(ctx, "/A/B", "2", backend.SetOptions{})
+	memory.Set(ctx, "/A/C", "3", backend.SetOptions{})
+	memory.Set(ctx, "/E", "4", backend.SetOptions{})
+	s := NewDendriteService(memory)
+	tests := []struct {
+		name    string
+		input   dto.QueryInput
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name:  "should place aliased fields under their alias",
+			input: dto.QueryInput{Query: `{ old: A { b: B(version: 1) } new: A { B } }`},
+			want: map[string]any{
+				"old": map[string]any{"b": "1"},
+				"new": map[string]any{"B": "2"},
+			},
+		},
+		{
+			name: "should read versions from variables",
+			input: dto.QueryInput{
+				Query:     `query ($v: Int!) { A { B(version: $v) } }`,
+				Variables: map[string]any{"v": float64(1)},
+			},
+			want: map[string]any{"A": map[string]any{"B": "1"}},
+		},
+		{
+			name:  "should use the default value of variables",
+			input: dto.QueryInput{Query: `query ($v: Int = 1) { A { B(version: $v) } }`},
+			want:  map[string]any{"A": map[string]any{"B": "1"}},
+		},
+		{
+			name:  "should inline fragments",
+			input: dto.QueryInput{Query: `{ A { ...leaves } ... on Config { E } } fragment leaves on A { B C }`},
+			want: map[string]any{
+				"A": map[string]any{"B": "2", "C": "3"},
+				"E": "4",
+			},
+		},
+		{
+			name: "should apply directives",
+			input: dto.QueryInput{
+				Query:     `query ($skip: Boolean!) { A { B @skip(if: $skip) C @include(if: false) } E @include(if: true) }`,
+				Variables: map[string]any{"skip": true},
+			},
+			want: map[string]any{"E": "4"},
+		},
+		{
+			name:  "should merge repeated fields",
+			input: dto.QueryInput{Query: `{ E E A { B } A { B C } }`},
+			want: map[string]any{
+				"A": map[string]any{"B": "2", "C": "3"},
+				"E": "4",
+			},
+		},
+		{
+			name:  "should run the named operation",
+			input: dto.QueryInput{Query: `query a { A { B } } query e { E }`, OperationName: "e"},
+			want:  map[string]any{"E": "4"},
+		},
+		{
+			name:    "want err: operation name is missing",
+			input:   dto.QueryInput{Query: `query a { A { B } } query e { E }`},
+			wantErr: true,
+		},
+		{
+			name:    "want err: unknown operation",
+			input:   dto.QueryInput{Query: `query a { A { B } }`, OperationName: "b"},
+			wantErr: true,
+		},
+		{
+			name:    "want err: required variable is missing",
+			input:   dto.QueryInput{Query: `query ($v: Int!) { A { B(version: $v) } }`},
+			wantErr: true,
+		},
+		{
+			name:    "want err: variable is not defined",
+			input:   dto.QueryInput{Query: `{ A { B(version: $v) } }`},
+			wantErr: true,
+		},
+		{
+			name:    "want err: unknown fragment",
+			input:   dto.QueryInput{Query: `{ ...missing }`},
+			wantErr: true,
+		},
+		{
+			name:    "want err: fragment spreads itself",
+			input:   dto.QueryInput{Query: `{ ...a } fragment a on Config { A { ...a } }`},
+			wantErr: true,
+		},
+		{
+			name:    "want err: unknown directive",
+			input:   dto.QueryInput{Query: `{ E @deprecated }`},
+			wantErr: true,
+		},
+		{
+			name:    "want err: conflicting versions",
+			input:   dto.QueryInput{Query: `{ A { B(version: 1) B } }`},
+			wantErr: true,
+		},
+		{
+			name:    "want err: conflicting fields",
+			input:   dto.QueryInput{Query: `{ x: E x: A { B } }`},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Execute(ctx, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DendriteService.Execute() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var queryErr *QueryError
+			if err != nil && !errors.As(err, &queryErr) {
+				t.Errorf("DendriteService.Execute() error = %#v, want a QueryError", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DendriteService.Execute() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// introspectionQuery is the introspection query sent by GraphQL IDEs
+const introspectionQuery = `
+query IntrospectionQuery {
+	__schema {
+		queryType { name }
+		mutationType { name }
+		subscriptionType { name }
+		types { ...FullType }
+		directives { name description locations args { ...InputValue } }
+	}
+}
+fragment FullType on __Type {
+	kind name description
+	fields(includeDeprecated: true) { name description args { ...InputValue } type { ...TypeRef } isDeprecated deprecationReason }
+	inputFields { ...InputValue }
+	interfaces { ...TypeRef }
+	enumValues(includeDeprecated: true) { name description isDeprecated deprecationReason }
+	possibleTypes { ...TypeRef }
+}
+fragment InputValue on __InputValue { name description type { ...TypeRef } defaultValue }
+fragment TypeRef on __Type { kind name ofType { kind name ofType { kind name ofType { kind name } } } }
+`
+
+func TestDendriteService_Introspection(t *testing.T) {
+	ctx := context.Background()
+	memory := backend.NewMemoryBackend()
+	memory.Set(ctx, "/services/foo/port", "80", backend.SetOptions{})
+	memory.SetMany(ctx, "/services/foo/hosts", []string{"a", "b"}, backend.SetOptions{})
+	memory.Set(ctx, "/E", "1", backend.SetOptions{})
+	memory.Set(ctx, "/not-a-name", "1", backend.SetOptions{})
+	s := NewDendriteService(memory)
+
+	t.Run("should generate object types for inner paths", func(t *testing.T) {
+		got, err := s.Execute(ctx, dto.QueryInput{Query: `{
+			__typename
+			__schema { queryType { name fields { name type { kind name } } } }
+			__type(name: "services_foo") {
+				kind
+				fields { name args { name type { name } } type { kind name ofType { kind ofType { kind name } } } }
+			}
+		}`})
+		want := map[string]any{
+			"__typename": "Query",
+			"__schema": map[string]any{
+				"queryType": map[string]any{
+					"name": "Query",
+					"fields": []any{
+						map[string]any{"name": "E", "type": map[string]any{"kind": "SCALAR", "name": "String"}},
+						map[string]any{"name": "services", "type": map[string]any{"kind": "OBJECT", "name": "services"}},
+					},
+				},
+			},
+			"__type": map[string]any{
+				"kind": "OBJECT",
+				"fields": []any{
+					map[string]any{
+						"name": "hosts",
+						"args": []any{
+							map[string]any{"name": "version", "type": map[string]any{"name": "Int"}},
+							map[string]any{"name": "at", "type": map[string]any{"name": "String"}},
+						},
+						"type": map[string]any{"kind": "LIST", "name": nil, "ofType": map[string]any{
+							"kind":   "NON_NULL",
+							"ofType": map[string]any{"kind": "SCALAR", "name": "String"},
+						}},
+					},
+					map[string]any{
+						"name": "port",
+						"args": []any{
+							map[string]any{"name": "version", "type": map[string]any{"name": "Int"}},
+							map[string]any{"name": "at", "type": map[string]any{"name": "String"}},
+						},
+						"type": map[string]any{"kind": "SCALAR", "name": "String", "ofType": nil},
+					},
+				},
+			},
+		}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.Execute() = %#v, %v, want %#v", got, err, want)
+		}
+	})
+	t.Run("should answer the introspection query of GraphQL IDEs", func(t *testing.T) {
+		got, err := s.Execute(ctx, dto.QueryInput{Query: introspectionQuery})
+		if err != nil {
+			t.Fatalf("DendriteService.Execute() error = %v", err)
+		}
+		schema := got["__schema"].(map[string]any)
+		names := map[string]bool{}
+		for _, t := range schema["types"].([]any) {
+			names[t.(map[string]any)["name"].(string)] = true
+		}
+		for _, name := range []string{"Query", "services", "services_foo", "String", "__Type"} {
+			if !names[name] {
+				t.Errorf("type %s is missing from %v", name, names)
+			}
+		}
+		if len(schema["directives"].([]any)) == 0 || !reflect.DeepEqual(schema["mutationType"], map[string]any{"name": "Mutation"}) ||
+			!reflect.DeepEqual(schema["subscriptionType"], map[string]any{"name": "Subscription"}) {
+			t.Errorf("unexpected schema %#v", schema)
+		}
+	})
+	t.Run("should return null for unknown types", func(t *testing.T) {
+		got, err := s.Execute(ctx, dto.QueryInput{Query: `{ __type(name: "Missing") { name } }`})
+		want := map[string]any{"__type": nil}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.Execute() = %#v, %v, want %#v", got, err, want)
+		}
+	})
+	t.Run("should mix config and introspection fields", func(t *testing.T) {
+		got, err := s.Execute(ctx, dto.QueryInput{Query: `{ E __type(name: "Query") { name } }`})
+		want := map[string]any{"E": "1", "__type": map[string]any{"name": "Query"}}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.Execute() = %#v, %v, want %#v", got, err, want)
+		}
+	})
+}
+
+func TestDendriteService_Mutation(t *testing.T) {
+	ctx := context.Background()
+	memory := backend.NewMemoryBackend()
+	s := NewDendriteService(memory)
+
+	t.Run("should apply every write and return their metadata", func(t *testing.T) {
+		got, err := s.Execute(ctx, dto.QueryInput{
+			Query: `mutation ($hosts: [String!]!) {
+				port: set(path: "/svc/port", value: "80") { path latestVersion currentVersion }
+				hosts: setMany(path: "/svc/hosts", values: $hosts, expectedVersion: 0) { latestVersion }
+				next: set(path: "/svc/port", value: "81", keepCurrent: true) { latestVersion currentVersion }
+			}`,
+			Variables: map[string]any{"hosts": []any{"a", "b"}},
+		})
+		want := map[string]any{
+			"port":  map[string]any{"path": "/svc/port", "latestVersion": 1, "currentVersion": 1},
+			"hosts": map[string]any{"latestVersion": 1},
+			"next":  map[string]any{"latestVersion": 2, "currentVersion": 1},
+		}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.Execute() = %#v, %v, want %#v", got, err, want)
+		}
+		if values, _ := memory.GetManyCurrent(ctx, "/svc/hosts"); !reflect.DeepEqual(values, []string{"a", "b"}) {
+			t.Errorf("values of /svc/hosts = %#v", values)
+		}
+	})
+	t.Run("should write nothing when an expected version does not match", func(t *testing.T) {
+		_, err := s.Execute(ctx, dto.QueryInput{Query: `mutation {
+			set(path: "/svc/name", value: "a") { latestVersion }
+			setMany(path: "/svc/port", values: ["82"], expectedVersion: 1) { latestVersion }
+		}`})
+		var conflictErr *backend.ConflictErr
+		if !errors.As(err, &conflictErr) {
+			t.Errorf("DendriteService.Execute() error = %v, want a ConflictErr", err)
+		}
+		if _, err := memory.GetMetadata(ctx, "/svc/name"); err == nil {
+			t.Errorf("/svc/name was written")
+		}
+	})
+	t.Run("should reject invalid mutations before writing", func(t *testing.T) {
+		for _, query := range []string{
+			`mutation { set(path: "/x", value: "1") { unknown } }`,
+			`mutation { set(path: "/x", value: "1") }`,
+			`mutation { set(path: "x", value: "1") { path } }`,
+			`mutation { set(path: "/x", value: 1) { path } }`,
+			`mutation { delete(path: "/x") { path } }`,
+		} {
+			_, err := s.Execute(ctx, dto.QueryInput{Query: query})
+			var queryErr *QueryError
+			if !errors.As(err, &queryErr) {
+				t.Errorf("DendriteService.Execute(%s) error = %v, want a QueryError", query, err)
+			}
+		}
+		if _, err := memory.GetMetadata(ctx, "/x"); err == nil {
+			t.Errorf("/x was written")
+		}
+	})
+}
+
+func TestDendriteService_Meta(t *testing.T) {
+	ctx := context.Background()
+	memory := backend.NewMemoryBackend()
+	memory.Set(ctx, "/svc/port", "80", backend.SetOptions{})
+	memory.Set(ctx, "/svc/port", "81", backend.SetOptions{KeepCurrent: true})
+	s := NewDendriteService(memory)
+	metadata, err := memory.GetMetadata(ctx, "/svc/port")
+	if err != nil {
+		t.Fatalf("failed to get metadata: %v", err)
+	}
+	updatedAt := metadata.UpdatedAt.Format(time.RFC3339Nano)
+
+	tests := []struct {
+		name    string
+		input   dto.QueryInput
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name:  "should return the metadata of the current version next to the value",
+			input: dto.QueryInput{Query: `{ svc { port meta: port { _meta { version latestVersion updatedAt } } } }`},
+			want: map[string]any{"svc": map[string]any{
+				"port": "80",
+				"meta": map[string]any{"_meta": map[string]any{"version": 1, "latestVersion": 2, "updatedAt": updatedAt}},
+			}},
+		},
+		{
+			name:  "should return the version read",
+			input: dto.QueryInput{Query: `{ svc { port(version: 2) { m: _meta { v: version } _meta { latestVersion } } } }`},
+			want: map[string]any{"svc": map[string]any{"port": map[string]any{
+				"m":     map[string]any{"v": 2},
+				"_meta": map[string]any{"latestVersion": 2},
+			}}},
+		},
+		{
+			name:  "should leave out the metadata of missing versions",
+			input: dto.QueryInput{Query: `{ svc { port(version: 3) { _meta { version } } missing { _meta { version } } } }`},
+			want:  map[string]any{},
+		},
+		{
+			name:    "should reject other fields next to _meta",
+			input:   dto.QueryInput{Query: `{ svc { port { _meta { version } other } } }`},
+			wantErr: true,
+		},
+		{
+			name:    "should reject unknown fields of _meta",
+			input:   dto.QueryInput{Query: `{ svc { port { _meta { createdBy } } } }`},
+			wantErr: true,
+		},
+		{
+			name:    "should reject a value and _meta under the same key",
+			input:   dto.QueryInput{Query: `{ svc { port port { _meta { version } } } }`},
+			wantErr: true,
+		},
+		{
+			name:    "should reject fields of a leaf selecting _meta",
+			input:   dto.QueryInput{Query: `{ svc { _meta { version } } svc { port } }`},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Execute(ctx, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DendriteService.Execute() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DendriteService.Execute() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("should read the metadata at once, matching the values returned", func(t *testing.T) {
+		writing := &writingBackend{Backend: memory}
+		s := NewDendriteService(writing)
+		got, err := s.Query(ctx, `{ svc { port p: port { _meta { version } } v: port(version: 2) { _meta { latestVersion } } } }`)
+		if err != nil {
+			t.Fatalf("DendriteService.Query() error = %v", err)
+		}
+		want := map[string]any{"svc": map[string]any{
+			"port": "80",
+			"p":    map[string]any{"_meta": map[string]any{"version": 1}},
+			"v":    map[string]any{"_meta": map[string]any{"latestVersion": 2}},
+		}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.Query() = %#v, want %#v", got, want)
+		}
+		if writing.getMetadata != 0 || writing.getManyMetadata != 1 {
+			t.Errorf("GetMetadata called %d times and GetManyMetadata %d times, want 0 and 1", writing.getMetadata, writing.getManyMetadata)
+		}
+	})
+}
+
+// writingBackend writes a new current version of /svc/port right after every GetManyMetadata, like a concurrent write
+type writingBackend struct {
+	backend.Backend
+	getMetadata, getManyMetadata int
+}
+
+func (b *writingBackend) GetMetadata(ctx context.Context, path string) (*backend.Metadata, error) {
+	b.getMetadata++
+	return b.Backend.GetMetadata(ctx, path)
+}
+
+func (b *writingBackend) GetManyMetadata(ctx context.Context, paths []string) ([]*backend.Metadata, error) {
+	b.getManyMetadata++
+	result, err := b.Backend.GetManyMetadata(ctx, paths)
+	b.Backend.Set(ctx, "/svc/port", "90", backend.SetOptions{})
+	return result, err
+}
+
+func TestDendriteService_At(t *testing.T) {
+	ctx := context.Background()
+	memory := backend.NewMemoryBackend()
+	first, _ := memory.Set(ctx, "/svc/port", "80", backend.SetOptions{})
+	memory.Set(ctx, "/svc/host", "a", backend.SetOptions{})
+	memory.Set(ctx, "/svc/port", "81", backend.SetOptions{})
+	s := NewDendriteService(memory)
+	at := first.UpdatedAt.Format(time.RFC3339Nano)
+
+	t.Run("should read the versions which were current at the time", func(t *testing.T) {
+		got, err := s.Execute(ctx, dto.QueryInput{
+			Query:     `query ($at: String) { svc { port(at: $at) host(at: $at) now: port meta: port(at: $at) { _meta { version } } } }`,
+			Variables: map[string]any{"at": at},
+		})
+		want := map[string]any{"svc": map[string]any{
+			"port": "80",
+			"now":  "81",
+			"meta": map[string]any{"_meta": map[string]any{"version": 1}},
+		}}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.Execute() = %#v, %v, want %#v", got, err, want)
+		}
+	})
+	t.Run("should reject invalid times", func(t *testing.T) {
+		for _, query := range []string{
+			`{ svc { port(at: "yesterday") } }`,
+			`{ svc { port(at: 1) } }`,
+			`{ svc { port(at: "` + at + `", version: 1) } }`,
+			`{ svc { port(at: "` + at + `") port } }`,
+		} {
+			_, err := s.Execute(ctx, dto.QueryInput{Query: query})
+			var queryErr *QueryError
+			if !errors.As(err, &queryErr) {
+				t.Errorf("DendriteService.Execute(%s) error = %v, want a QueryError", query, err)
+			}
+		}
+	})
+	t.Run("should export the values which were current at the time", func(t *testing.T) {
+		got, err := s.ExportAt(ctx, "/svc", first.UpdatedAt)
+		want := map[string][]string{"/svc/port": {"80"}}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.ExportAt() = %#v, %v, want %#v", got, err, want)
+		}
+		values, err := s.GetManyAt(ctx, "/svc/port", first.UpdatedAt.Add(-time.Nanosecond))
+		if err != nil || len(values) != 0 {
+			t.Errorf("DendriteService.GetManyAt() = %#v, %v, want no values", values, err)
+		}
+	})
+}
+
+func TestDendriteService_Revision(t *testing.T) {
+	ctx := context.Background()
+	memory := backend.NewMemoryBackend()
+	memory.Set(ctx, "/svc/port", "80", backend.SetOptions{})
+	memory.Batch(ctx, []backend.Change{{Path: "/svc/host", Values: []string{"a"}}, {Path: "/svc/port", Values: []string{"81"}}})
+	memory.Set(ctx, "/svc/host", "b", backend.SetOptions{})
+	s := NewDendriteService(memory)
+	one, two := 1, 2
+
+	t.Run("should read every path at the revision", func(t *testing.T) {
+		got, revision, err := s.ExecuteWithRevision(ctx, dto.QueryInput{
+			Query:    `{ svc { port host latest: host(version: 2) meta: port { _meta { version } } } }`,
+			Revision: &one,
+		})
+		want := map[string]any{"svc": map[string]any{
+			"port":   "80",
+			"latest": "b",
+			"meta":   map[string]any{"_meta": map[string]any{"version": 1}},
+		}}
+		if err != nil || revision != 1 || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.ExecuteWithRevision() = %#v, %d, %v, want %#v, 1", got, revision, err, want)
+		}
+	})
+	t.Run("should return the latest revision of queries and the written revision of mutations", func(t *testing.T) {
+		_, revision, err := s.ExecuteWithRevision(ctx, dto.QueryInput{Query: `{ svc { port } }`})
+		if err != nil || revision != 3 {
+			t.Errorf("DendriteService.ExecuteWithRevision() revision = %d, %v, want 3", revision, err)
+		}
+		got, revision, err := s.ExecuteWithRevision(ctx, dto.QueryInput{Query: `mutation { set(path: "/svc/port", value: "82") { revision } }`})
+		want := map[string]any{"set": map[string]any{"revision": 4}}
+		if err != nil || revision != 4 || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.ExecuteWithRevision() = %#v, %d, %v, want %#v, 4", got, revision, err, want)
+		}
+	})
+	t.Run("should reject revisions which do not exist and revisions of mutations", func(t *testing.T) {
+		missing, negative := 100, -1
+		for _, input := range []dto.QueryInput{
+			{Query: `{ svc { port } }`, Revision: &missing},
+			{Query: `{ svc { port } }`, Revision: &negative},
+			{Query: `mutation { set(path: "/svc/port", value: "83") { revision } }`, Revision: &one},
+		} {
+			_, err := s.Execute(ctx, input)
+			var queryErr *QueryError
+			if !errors.As(err, &queryErr) {
+				t.Errorf("DendriteService.Execute(%s) error = %v, want a QueryError", input.Query, err)
+			}
+		}
+		router, err := backend.NewRouterBackend([]backend.Mount{{Prefix: "/", Backend: backend.NewMemoryBackend()}})
+		if err != nil {
+			t.Fatalf("NewRouterBackend() error = %v", err)
+		}
+		_, err = NewDendriteService(router).Execute(ctx, dto.QueryInput{Query: `{ svc { port } }`, Revision: &one})
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("DendriteService.Execute() error = %v, want a QueryError as the router has no revisions", err)
+		}
+	})
+	t.Run("should export the tree at the revision", func(t *testing.T) {
+		got, err := s.ExportAtRevision(ctx, "/svc", two)
+		want := map[string][]string{"/svc/port": {"81"}, "/svc/host": {"a"}}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.ExportAtRevision() = %#v, %v, want %#v", got, err, want)
+		}
+	})
+	t.Run("should return the revision in a header", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		controller := NewDendriteController(s, zap.NewNop().Sugar(), &backend.Config{Type: "memory"}, &SubscriptionConfig{Interval: time.Second})
+		router := gin.New()
+		controller.RegisterControllerRoutes(router.Group("/v1"))
+		for _, tt := range []struct {
+			method, target, body, want string
+		}{
+			{"GET", "/v1/query?query={svc{port}}&revision=2", "", "2"},
+			{"POST", "/v1/export", `{"prefix": "/svc"}`, "4"},
+			{"POST", "/v1/set", `{"path": "/svc/port", "value": "84"}`, "5"},
+		} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if got := recorder.Header().Get(RevisionHeader); got != tt.want {
+				t.Errorf("%s %s revision = %q, want %q", tt.method, tt.target, got, tt.want)
+			}
+		}
+	})
+}
+
+func TestDendriteService_Output(t *testing.T) {
+	ctx := context.Background()
+	memory := backend.NewMemoryBackend()
+	memory.SetMany(ctx, "/A/B", []string{"C", "D"}, backend.SetOptions{})
+	memory.Set(ctx, "/A/B/C", "1", backend.SetOptions{})
+	s := NewDendriteService(memory)
+
+	tests := []struct {
+		name  string
+		input dto.QueryInput
+		want  map[string]any
+	}{
+		{
+			name:  "should return the selected children of a parent in the nested output",
+			input: dto.QueryInput{Query: `{ A { B { C } } }`},
+			want:  map[string]any{"A": map[string]any{"B": map[string]any{"C": "1"}}},
+		},
+		{
+			name:  "should return nodes with values and children in the node output",
+			input: dto.QueryInput{Query: `{ A { B } A { B { C } } }`, Output: dto.OutputNode},
+			want: map[string]any{"children": map[string]any{
+				"A": map[string]any{"children": map[string]any{
+					"B": map[string]any{
+						"values":   []string{"C", "D"},
+						"children": map[string]any{"C": map[string]any{"values": []string{"1"}}},
+					},
+				}},
+			}},
+		},
+		{
+			name:  "should return _meta objects as nodes with meta in the node output",
+			input: dto.QueryInput{Query: `{ A { B { meta: C { _meta { version } } } } }`, Output: dto.OutputNode},
+			want: map[string]any{"children": map[string]any{
+				"A": map[string]any{"children": map[string]any{
+					"B": map[string]any{"children": map[string]any{
+						"meta": map[string]any{"children": map[string]any{"_meta": map[string]any{"meta": map[string]any{"version": 1}}}},
+					}},
+				}},
+			}},
+		},
+		{
+			name:  "should return an empty root node when nothing is found",
+			input: dto.QueryInput{Query: `{ missing }`, Output: dto.OutputNode},
+			want:  map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Execute(ctx, tt.input)
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DendriteService.Execute() = %#v, %v, want %#v", got, err, tt.want)
+			}
+		})
+	}
+	t.Run("should reject unknown output modes, introspection in the node output and parents with values in the nested output", func(t *testing.T) {
+		for _, input := range []dto.QueryInput{
+			{Query: `{ A { B } }`, Output: "tree"},
+			{Query: `{ __typename A { B } }`, Output: dto.OutputNode},
+			{Query: `{ A { B { C } } A { B } }`},
+			{Query: `{ A { B } A { B { C } } }`, Output: dto.OutputNested},
+		} {
+			_, err := s.Execute(ctx, input)
+			var queryErr *QueryError
+			if !errors.As(err, &queryErr) {
+				t.Errorf("DendriteService.Execute(%s) error = %v, want a QueryError", input.Query, err)
+			}
+		}
+	})
+}
+
+func TestDendriteService_Flat(t *testing.T) {
+	ctx := context.Background()
+	memory := backend.NewMemoryBackend()
+	memory.Set(ctx, "/svc/port", "80", backend.SetOptions{})
+	memory.Set(ctx, "/svc/port", "81", backend.SetOptions{})
+	memory.SetMany(ctx, "/svc/hosts", []string{"a", "b"}, backend.SetOptions{})
+	memory.Set(ctx, "/svc/hosts", "c", backend.SetOptions{KeepCurrent: true})
+	s := NewDendriteService(memory)
+
+	t.Run("should return the version and values of every key", func(t *testing.T) {
+		got, err := s.Execute(ctx, dto.QueryInput{
+			Query:  `{ svc { port old: port(version: 1) hosts missing } }`,
+			Output: dto.OutputFlat,
+		})
+		want := map[string]any{
+			"/svc/port":  dto.Version{Version: 2, Values: []string{"81"}},
+			"/svc/old":   dto.Version{Version: 1, Values: []string{"80"}},
+			"/svc/hosts": dto.Version{Version: 1, Values: []string{"a", "b"}},
+		}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.Execute() = %#v, %v, want %#v", got, err, want)
+		}
+	})
+	t.Run("should reject _meta", func(t *testing.T) {
+		_, err := s.Execute(ctx, dto.QueryInput{Query: `{ svc { port { _meta { version } } } }`, Output: dto.OutputFlat})
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("DendriteService.Execute() error = %v, want a QueryError", err)
+		}
+	})
+	t.Run("should export the version and values of every path", func(t *testing.T) {
+		got, err := s.ExportVersions(ctx, dto.ExportInput{Prefix: "/svc"})
+		want := map[string]dto.Version{
+			"/svc/port":  {Version: 2, Values: []string{"81"}},
+			"/svc/hosts": {Version: 1, Values: []string{"a", "b"}},
+		}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.ExportVersions() = %#v, %v, want %#v", got, err, want)
+		}
+		one := 1
+		got, err = s.ExportVersions(ctx, dto.ExportInput{Prefix: "/svc", Revision: &one})
+		want = map[string]dto.Version{"/svc/port": {Version: 1, Values: []string{"80"}}}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.ExportVersions() = %#v, %v, want %#v", got, err, want)
+		}
+	})
+	t.Run("should select the flat output by query parameter or header", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		controller := NewDendriteController(s, zap.NewNop().Sugar(), &backend.Config{Type: "memory"}, &SubscriptionConfig{Interval: time.Second})
+		router := gin.New()
+		controller.RegisterControllerRoutes(router.Group("/v1"))
+		for _, tt := range []struct {
+			target, header, body string
+			status               int
+			want                 string
+		}{
+			{"/v1/query?output=flat", "", `{"query": "{ svc { port } }"}`, 200, `{"data":{"/svc/port":{"version":2,"values":["81"]}}}`},
+			{"/v1/export", "flat", `{"prefix": "/svc/port"}`, 200, `{"/svc/port":{"version":2,"values":["81"]}}`},
+			{"/v1/export?output=nested", "flat", `{"prefix": "/svc/port"}`, 200, `{"/svc/port":["81"]}`},
+			{"/v1/getMany?output=flat", "", `{"path": "/svc/hosts", "version": 2}`, 200, `{"/svc/hosts":{"version":2,"values":["c"]}}`},
+			{"/v1/getManyCurrent", "flat", `{"path": "/svc/hosts"}`, 200, `{"/svc/hosts":{"version":1,"values":["a","b"]}}`},
+			{"/v1/getManyCurrent", "flat", `{"path": "/missing"}`, 200, `{}`},
+			{"/v1/export", "node", `{"prefix": "/svc"}`, 400, `{"message":"unknown output mode node, expected nested or flat"}`},
+		} {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body))
+			request.Header.Set(OutputHeader, tt.header)
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != tt.status || recorder.Body.String() != tt.want {
+				t.Errorf("POST %s = %d %s, want %d %s", tt.target, recorder.Code, recorder.Body, tt.status, tt.want)
+			}
+		}
+	})
+	t.Run("should read the current versions of every key at once", func(t *testing.T) {
+		writing := &writingBackend{Backend: memory}
+		s := NewDendriteService(writing)
+		got, err := s.Execute(ctx, dto.QueryInput{Query: `{ svc { port hosts missing } }`, Output: dto.OutputFlat})
+		want := map[string]any{
+			"/svc/port":  dto.Version{Version: 2, Values: []string{"81"}},
+			"/svc/hosts": dto.Version{Version: 1, Values: []string{"a", "b"}},
+		}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("DendriteService.Execute() = %#v, %v, want %#v", got, err, want)
+		}
+		if writing.getMetadata != 0 || writing.getManyMetadata != 1 {
+			t.Errorf("GetMetadata called %d times and GetManyMetadata %d times, want 0 and 1", writing.getMetadata, writing.getManyMetadata)
+		}
+	})
+}
+
+func TestDendriteService_Subscribe(t *testing.T) {
+	memory := backend.NewMemoryBackend()
+	memory.Set(context.Background(), "/svc/port", "80", backend.SetOptions{})
+	s := NewDendriteService(memory)
+
+	t.Run("should send the result again when it changes", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		results := make(chan map[string]any)
+		done := make(chan error)
+		go func() {
+			done <- s.Subscribe(ctx, dto.QueryInput{Query: `subscription { svc { port } }`}, time.Millisecond, func(object map[string]any, err error) error {
+				results <- object
+				return err
+			})
+		}()
+		want := map[string]any{"svc": map[string]any{"port": "80"}}
+		if got := <-results; !reflect.DeepEqual(got, want) {
+			t.Errorf("first result = %#v, want %#v", got, want)
+		}
+		memory.Set(context.Background(), "/svc/port", "81", backend.SetOptions{})
+		want = map[string]any{"svc": map[string]any{"port": "81"}}
+		if got := <-results; !reflect.DeepEqual(got, want) {
+			t.Errorf("second result = %#v, want %#v", got, want)
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("DendriteService.Subscribe() error = %v", err)
+		}
+	})
+	t.Run("should only run the query again when the revision moves", func(t *testing.T) {
+		counting := &countingBackend{Backend: memory}
+		s := NewDendriteService(counting)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		results := make(chan map[string]any)
+		go s.Subscribe(ctx, dto.QueryInput{Query: `subscription { svc { port } }`}, time.Millisecond, func(object map[string]any, err error) error {
+			results <- object
+			return err
+		})
+		<-results
+		time.Sleep(20 * time.Millisecond)
+		if got := atomic.LoadInt32(&counting.reads); got != 1 {
+			t.Errorf("reads = %d without writes, want 1", got)
+		}
+		memory.Set(context.Background(), "/svc/port", "82", backend.SetOptions{})
+		want := map[string]any{"svc": map[string]any{"port": "82"}}
+		if got := <-results; !reflect.DeepEqual(got, want) {
+			t.Errorf("second result = %#v, want %#v", got, want)
+		}
+	})
+	t.Run("should send a single result for queries", func(t *testing.T) {
+		results := []map[string]any{}
+		err := s.Subscribe(context.Background(), dto.QueryInput{Query: `{ svc { port } }`}, time.Millisecond, func(object map[string]any, err error) error {
+			results = append(results, object)
+			return err
+		})
+		if err != nil || len(results) != 1 {
+			t.Errorf("DendriteService.Subscribe() = %#v, %v, want a single result", results, err)
+		}
+	})
+	t.Run("should reject subscriptions of several root fields", func(t *testing.T) {
+		err := s.Subscribe(context.Background(), dto.QueryInput{Query: `subscription { a b }`}, time.Millisecond, func(map[string]any, error) error {
+			return nil
+		})
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("DendriteService.Subscribe() error = %v, want a QueryError", err)
+		}
+	})
+	t.Run("should reject subscriptions outside of a WebSocket", func(t *testing.T) {
+		_, err := s.Execute(context.Background(), dto.QueryInput{Query: `subscription { svc { port } }`})
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("DendriteService.Execute() error = %v, want a QueryError", err)
+		}
+	})
+}
+
+// countingBackend counts the calls of GetManyPaths
+type countingBackend struct {
+	backend.Backend
+	reads int32
+}
+
+func (b *countingBackend) GetManyPaths(ctx context.Context, selections []backend.Selection) ([][]string, error) {
+	atomic.AddInt32(&b.reads, 1)
+	return b.Backend.GetManyPaths(ctx, selections)
+}
+
+func TestDendriteController_Subscribe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	memory := backend.NewMemoryBackend()
+	memory.Set(context.Background(), "/svc/port", "80", backend.SetOptions{})
+	controller := NewDendriteController(NewDendriteService(memory), zap.NewNop().Sugar(), &backend.Config{Type: "memory"}, &SubscriptionConfig{Interval: time.Millisecond})
+	router := gin.New()
+	controller.RegisterControllerRoutes(router.Group("/v1"))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{graphqlTransportWS}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/query", nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	read := func(want string) string {
+		var message wsMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("failed to read a %s message: %v", want, err)
+		}
+		if message.Type != want {
+			t.Fatalf("message = %s %s, want a %s message", message.Type, message.Payload, want)
+		}
+		return string(message.Payload)
+	}
+
+	conn.WriteJSON(map[string]any{"type": "connection_init"})
+	read("connection_ack")
+	conn.WriteJSON(map[string]any{"id": "1", "type": "subscribe", "payload": map[string]any{"query": `subscription { svc { port } }`}})
+	if got, want := read("next"), `{"data":{"svc":{"port":"80"}}}`; got != want {
+		t.Errorf("payload = %s, want %s", got, want)
+	}
+	memory.Set(context.Background(), "/svc/port", "81", backend.SetOptions{})
+	if got, want := read("next"), `{"data":{"svc":{"port":"81"}}}`; got != want {
+		t.Errorf("payload = %s, want %s", got, want)
+	}
+	conn.WriteJSON(map[string]any{"id": "1", "type": "complete"})
+
+	conn.WriteJSON(map[string]any{"id": "2", "type": "subscribe", "payload": map[string]any{"query": `{ svc { port } }`}})
+	if got, want := read("next"), `{"data":{"svc":{"port":"81"}}}`; got != want {
+		t.Errorf("payload = %s, want %s", got, want)
+	}
+	read("complete")
+	conn.WriteJSON(map[string]any{"id": "3", "type": "subscribe", "payload": map[string]any{"query": `{`}})
+	read("error")
 }
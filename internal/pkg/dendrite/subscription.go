@@ -0,0 +1,289 @@
+package dendrite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/laminatedio/dendrite/internal/pkg/dendrite/dto"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+type SubscriptionConfig struct {
+	// Interval between the checks of every subscription for changed values. A check reads the latest revision,
+	// the query of the subscription only runs again when it has moved or when the backend has no revisions.
+	Interval time.Duration `mapstructure:"interval" validate:"required"`
+}
+
+func init() {
+	viper.SetDefault("subscriptions.interval", time.Second)
+}
+
+// Subscribe runs the operation of input and sends its result.
+// Subscriptions check the latest revision every interval until ctx is done and run again when it has moved,
+// or on every check with backends without revisions, sending the result whenever it differs from the last one,
+// while queries and mutations send a single result.
+// Errors before the first result are returned, later errors are sent and the subscription goes on.
+func (s *DendriteService) Subscribe(ctx context.Context, input dto.QueryInput, interval time.Duration, send func(map[string]any, error) error) error {
+	operation, err := parseOperation(input)
+	if err != nil {
+		return err
+	}
+	variables, err := coerceVariables(operation.VariableDefinitions, input.Variables)
+	if err != nil {
+		return err
+	}
+	options, err := getQueryOptions(input)
+	if err != nil {
+		return err
+	}
+	if operation.Operation != ast.Subscription {
+		object, _, err := s.execute(ctx, operation, variables, options)
+		if err != nil {
+			return err
+		}
+		return send(object, nil)
+	}
+	if input.Revision != nil {
+		return queryErrorf("a revision can only be given for queries")
+	}
+	fields, err := collectFields(operation.SelectionSet, variables)
+	if err != nil {
+		return err
+	}
+	if len(fields) != 1 {
+		return queryErrorf("a subscription must select exactly one root field, it selects %d", len(fields))
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last map[string]any
+	var lastErr error
+	// revision is the revision read before the last run of the query, -1 when it is unknown
+	revision := -1
+	for first := true; ; first = false {
+		latest, err := s.backend.Revision(ctx)
+		if err != nil {
+			latest = -1
+		}
+		if first || latest == -1 || latest != revision || lastErr != nil {
+			revision = latest
+			object, err := s.query(ctx, operation, variables, options)
+			if ctx.Err() != nil {
+				return nil
+			}
+			switch {
+			case err != nil && first:
+				return err
+			case err != nil:
+				// the same error is not sent again on every check
+				if lastErr == nil || lastErr.Error() != err.Error() {
+					if err := send(nil, err); err != nil {
+						return err
+					}
+				}
+				last, lastErr = nil, err
+			case first || lastErr != nil || !reflect.DeepEqual(object, last):
+				if err := send(object, nil); err != nil {
+					return err
+				}
+				last, lastErr = object, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// graphqlTransportWS is the subprotocol of the graphql-ws library, https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const graphqlTransportWS = "graphql-transport-ws"
+
+// connectionInitTimeout is how long a connection may stay open without a connection_init message
+const connectionInitTimeout = 3 * time.Second
+
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{graphqlTransportWS},
+}
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsSession runs the operations of a WebSocket connection
+type wsSession struct {
+	conn     *websocket.Conn
+	service  *DendriteService
+	interval time.Duration
+
+	// writeMutex serializes the writes to conn, which are made by every running operation
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	// operations holds the cancel functions of the running operations by their ids
+	operations   map[string]context.CancelFunc
+	acknowledged bool
+	wait         sync.WaitGroup
+}
+
+// subscribe upgrades a GraphQL request to a WebSocket connection speaking the graphql-transport-ws protocol
+func (c *DendriteController) subscribe(ctx *gin.Context) {
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// the upgrader has responded with the error
+		return
+	}
+	session := &wsSession{
+		conn:       conn,
+		service:    c.dendriteService,
+		interval:   c.subscriptionConfig.Interval,
+		operations: map[string]context.CancelFunc{},
+	}
+	if conn.Subprotocol() != graphqlTransportWS {
+		session.close(4406, "Subprotocol not acceptable")
+		return
+	}
+	session.run(ctx.Request.Context())
+}
+
+func (w *wsSession) run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		w.wait.Wait()
+		w.conn.Close()
+	}()
+
+	timer := time.AfterFunc(connectionInitTimeout, func() {
+		w.mutex.Lock()
+		acknowledged := w.acknowledged
+		w.mutex.Unlock()
+		if !acknowledged {
+			w.close(4408, "Connection initialisation timeout")
+		}
+	})
+	defer timer.Stop()
+
+	for {
+		_, data, err := w.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var message wsMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			w.close(4400, "Invalid message received")
+			return
+		}
+		switch message.Type {
+		case "connection_init":
+			w.mutex.Lock()
+			acknowledged := w.acknowledged
+			w.acknowledged = true
+			w.mutex.Unlock()
+			if acknowledged {
+				w.close(4429, "Too many initialisation requests")
+				return
+			}
+			w.send(wsMessage{Type: "connection_ack"})
+		case "ping":
+			w.send(wsMessage{Type: "pong"})
+		case "pong":
+		case "subscribe":
+			var input dto.QueryInput
+			if message.ID == "" || json.Unmarshal(message.Payload, &input) != nil {
+				w.close(4400, "Invalid message received")
+				return
+			}
+			w.mutex.Lock()
+			acknowledged := w.acknowledged
+			_, exists := w.operations[message.ID]
+			if !acknowledged || exists {
+				w.mutex.Unlock()
+				if !acknowledged {
+					w.close(4401, "Unauthorized")
+				} else {
+					w.close(4409, fmt.Sprintf("Subscriber for %s already exists", message.ID))
+				}
+				return
+			}
+			operationCtx, cancelOperation := context.WithCancel(ctx)
+			w.operations[message.ID] = cancelOperation
+			w.mutex.Unlock()
+			w.wait.Add(1)
+			go w.execute(operationCtx, message.ID, input)
+		case "complete":
+			w.finish(message.ID)
+		default:
+			w.close(4400, "Invalid message received")
+			return
+		}
+	}
+}
+
+// execute runs an operation, sending its results until it completes, fails or is completed by the client
+func (w *wsSession) execute(ctx context.Context, id string, input dto.QueryInput) {
+	defer w.wait.Done()
+	err := w.service.Subscribe(ctx, input, w.interval, func(object map[string]any, err error) error {
+		response := QueryResponse{Data: object}
+		if err != nil {
+			response = QueryResponse{Errors: []Error{{Message: err.Error()}}}
+		}
+		payload, err := json.Marshal(response)
+		if err != nil {
+			return err
+		}
+		return w.send(wsMessage{ID: id, Type: "next", Payload: payload})
+	})
+	// operations completed by the client, or cancelled with the connection, get no further messages
+	if !w.finish(id) {
+		return
+	}
+	if err != nil {
+		message := err.Error()
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			message = "failed to run the operation: " + message
+		}
+		payload, _ := json.Marshal([]Error{{Message: message}})
+		w.send(wsMessage{ID: id, Type: "error", Payload: payload})
+		return
+	}
+	w.send(wsMessage{ID: id, Type: "complete"})
+}
+
+// finish cancels the operation id, reporting whether it was still running
+func (w *wsSession) finish(id string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	cancel, ok := w.operations[id]
+	if ok {
+		cancel()
+		delete(w.operations, id)
+	}
+	return ok
+}
+
+func (w *wsSession) send(message wsMessage) error {
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+	return w.conn.WriteJSON(message)
+}
+
+// close closes the connection with a close code of the protocol, which also stops the read loop of run
+func (w *wsSession) close(code int, reason string) {
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+	w.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	w.conn.Close()
+}
@@ -0,0 +1,71 @@
+package drift
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/laminatedio/dendrite/internal/pkg/state"
+)
+
+type Error struct {
+	Message string `json:"message"`
+}
+
+type SetDesiredInput struct {
+	Paths map[string][]string `json:"paths"`
+}
+
+type DriftController struct {
+	detector *Detector
+}
+
+func NewDriftController(detector *Detector) *DriftController {
+	return &DriftController{
+		detector: detector,
+	}
+}
+
+func (c *DriftController) Report(ctx *gin.Context) {
+	report := c.detector.Report()
+	if report == nil {
+		ctx.JSON(http.StatusServiceUnavailable, Error{
+			Message: "drift has not been checked yet",
+		})
+	} else {
+		ctx.JSON(http.StatusOK, report)
+	}
+}
+
+func (c *DriftController) SetDesired(ctx *gin.Context) {
+	json := &SetDesiredInput{}
+	err := ctx.BindJSON(json)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, Error{
+			Message: "failed to parse body, please check whether the request body is valid",
+		})
+	} else if err := state.State(json.Paths).Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, Error{
+			Message: err.Error(),
+		})
+	} else {
+		c.detector.SetDesired(state.State(json.Paths))
+		ctx.JSON(http.StatusAccepted, json)
+	}
+}
+
+func (c *DriftController) GetDesired(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, SetDesiredInput{
+		Paths: c.detector.Desired(),
+	})
+}
+
+func (c *DriftController) RoutePattern() string {
+	return "/drift"
+}
+
+func (c *DriftController) RegisterControllerRoutes(rg *gin.RouterGroup) {
+	rg.GET("", c.Report)
+	rg.GET("/desired", c.GetDesired)
+	rg.PUT("/desired", c.SetDesired)
+}
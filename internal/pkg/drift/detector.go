@@ -0,0 +1,156 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/state"
+)
+
+var (
+	driftedPaths = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dendrite_drifted_paths",
+		Help: "Number of declared paths whose current value differs from the desired state",
+	})
+	lastCheck = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "dendrite_drift_last_check_timestamp_seconds",
+		Help: "Unix time of the last successful drift check",
+	})
+	checkFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dendrite_drift_check_failures_total",
+		Help: "Number of drift checks which failed to read the backend",
+	})
+)
+
+type Config struct {
+	Interval time.Duration `mapstructure:"interval" validate:"required"`
+	// Files are YAML files or directories declaring the desired state, in the format of `dendrite apply`
+	Files []string `mapstructure:"files"`
+}
+
+func init() {
+	viper.SetDefault("drift.interval", time.Minute)
+}
+
+// Drift is a declared path whose current value differs from the desired one
+type Drift struct {
+	Path     string   `json:"path"`
+	Expected []string `json:"expected"`
+	// Actual is empty when the path does not exist
+	Actual []string `json:"actual"`
+}
+
+type Report struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	Drifts    []Drift   `json:"drifts"`
+}
+
+// Detector periodically compares the current values in the backend with a desired state
+type Detector struct {
+	backend backend.Backend
+	config  *Config
+	logger  *zap.SugaredLogger
+
+	mutex   sync.RWMutex
+	desired state.State
+	report  *Report
+	changed chan struct{}
+}
+
+func NewDetector(backend backend.Backend, config *Config, logger *zap.SugaredLogger) (*Detector, error) {
+	desired := state.State{}
+	if len(config.Files) > 0 {
+		var err error
+		desired, err = state.Load(config.Files...)
+		if err != nil {
+			return nil, fmt.Errorf("fail to load desired state: %w", err)
+		}
+	}
+	return &Detector{
+		backend: backend,
+		config:  config,
+		logger:  logger,
+		desired: desired,
+		changed: make(chan struct{}, 1),
+	}, nil
+}
+
+// SetDesired replaces the desired state and triggers a check
+func (d *Detector) SetDesired(desired state.State) {
+	d.mutex.Lock()
+	d.desired = desired
+	d.mutex.Unlock()
+	select {
+	case d.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Detector) Desired() state.State {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.desired
+}
+
+// Report returns the result of the last check, nil if no check has completed yet
+func (d *Detector) Report() *Report {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.report
+}
+
+// Check compares the desired state with the backend and records the result
+func (d *Detector) Check(ctx context.Context) (*Report, error) {
+	desired := d.Desired()
+	plan, err := state.NewPlan(ctx, d.backend, desired, nil)
+	if err != nil {
+		checkFailures.Inc()
+		return nil, err
+	}
+	report := &Report{
+		CheckedAt: time.Now(),
+		Drifts:    []Drift{},
+	}
+	for _, step := range plan.Steps {
+		report.Drifts = append(report.Drifts, Drift{
+			Path:     step.Path,
+			Expected: step.After,
+			Actual:   step.Before,
+		})
+	}
+
+	d.mutex.Lock()
+	d.report = report
+	d.mutex.Unlock()
+	driftedPaths.Set(float64(len(report.Drifts)))
+	lastCheck.Set(float64(report.CheckedAt.Unix()))
+	return report, nil
+}
+
+// Run checks for drift every interval until ctx is done
+func (d *Detector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+	for {
+		report, err := d.Check(ctx)
+		if err != nil {
+			d.logger.Errorf("fail to check drift: %v", err)
+		} else if len(report.Drifts) > 0 {
+			d.logger.Warnf("%d paths drifted from the desired state", len(report.Drifts))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.changed:
+		}
+	}
+}
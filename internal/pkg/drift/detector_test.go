@@ -0,0 +1,70 @@
+package drift
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/state"
+	backendmock "github.com/laminatedio/dendrite/mocks/internal_/pkg/backend"
+)
+
+func TestDetector_Check(t *testing.T) {
+	ctx := context.Background()
+	mock := &backendmock.Backend{}
+	mock.On("GetManyCurrent", ctx, "/A").Return([]string{"1"}, nil)
+	mock.On("GetManyCurrent", ctx, "/B").Return([]string{"changed by hand"}, nil)
+	mock.On("GetManyCurrent", ctx, "/C").Return(nil, &backend.NotFoundErr{Path: "/C"})
+
+	detector, err := NewDetector(mock, &Config{Interval: time.Minute}, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewDetector() error = %v", err)
+	}
+	if detector.Report() != nil {
+		t.Errorf("Detector.Report() = %v before any check, want nil", detector.Report())
+	}
+
+	tests := []struct {
+		name    string
+		desired state.State
+		want    []Drift
+	}{
+		{
+			name:    "should report nothing without a desired state",
+			desired: state.State{},
+			want:    []Drift{},
+		},
+		{
+			name: "should report changed and missing paths",
+			desired: state.State{
+				"/A": {"1"},
+				"/B": {"2"},
+				"/C": {"3"},
+			},
+			want: []Drift{
+				{Path: "/B", Expected: []string{"2"}, Actual: []string{"changed by hand"}},
+				{Path: "/C", Expected: []string{"3"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector.SetDesired(tt.desired)
+			got, err := detector.Check(ctx)
+			if err != nil {
+				t.Errorf("Detector.Check() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got.Drifts, tt.want) {
+				t.Errorf("Detector.Check() = %#v, want %#v", got.Drifts, tt.want)
+			}
+			if detector.Report() != got {
+				t.Errorf("Detector.Report() = %v, want the last check %v", detector.Report(), got)
+			}
+		})
+	}
+}
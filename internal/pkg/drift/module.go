@@ -0,0 +1,26 @@
+package drift
+
+import (
+	"context"
+
+	"github.com/astaclinic/astafx/routerfx"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Options(
+	fx.Provide(routerfx.AsControllerRoute(NewDriftController)),
+	fx.Provide(NewDetector),
+	fx.Invoke(func(lc fx.Lifecycle, d *Detector) {
+		ctx, cancel := context.WithCancel(context.Background())
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go d.Run(ctx)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				cancel()
+				return nil
+			},
+		})
+	}),
+)
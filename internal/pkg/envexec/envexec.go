@@ -0,0 +1,197 @@
+package envexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// validName matches the names of environment variables which shells accept
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Rules controls how paths are mapped to environment variables.
+// The path relative to the fetched prefix has every character other than letters, digits and underscores replaced
+// with underscores, so /services/foo/db/host-name fetched with prefix /services/foo becomes DB_HOST_NAME.
+type Rules struct {
+	// Prefix is prepended to every variable name
+	Prefix string
+	// Separator joins the values of paths holding multiple values
+	Separator string
+	// KeepCase disables upper casing of the variable names
+	KeepCase bool
+}
+
+// Name returns the variable name of path p fetched under prefix, empty for the prefix itself
+func (r Rules) Name(prefix string, p string) string {
+	relative := strings.Trim(strings.TrimPrefix(p, strings.TrimSuffix(prefix, "/")), "/")
+	if relative == "" {
+		return ""
+	}
+	name := []rune(relative)
+	for i, c := range name {
+		if !(c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			name[i] = '_'
+		}
+	}
+	if !r.KeepCase {
+		return r.Prefix + strings.ToUpper(string(name))
+	}
+	return r.Prefix + string(name)
+}
+
+// Environ maps the values fetched under prefix to sorted NAME=VALUE pairs.
+// It fails when a name is not a valid variable name, or when several paths map to the same name.
+func (r Rules) Environ(prefix string, values map[string][]string) ([]string, error) {
+	paths := make([]string, 0, len(values))
+	for p := range values {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	env := []string{}
+	seen := map[string]string{}
+	for _, p := range paths {
+		name := r.Name(prefix, p)
+		if name == "" {
+			continue
+		}
+		if !validName.MatchString(name) {
+			return nil, fmt.Errorf("%s maps to %s, which is not a valid variable name", p, name)
+		}
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("%s and %s both map to %s", other, p, name)
+		}
+		seen[name] = p
+		env = append(env, name+"="+strings.Join(values[p], r.Separator))
+	}
+	return env, nil
+}
+
+type OnChange string
+
+const (
+	// OnChangeNone leaves the child running with its original environment
+	OnChangeNone OnChange = "none"
+	// OnChangeRestart stops the child and starts it again with the new environment
+	OnChangeRestart OnChange = "restart"
+	// OnChangeSignal sends a signal to the child, for programs re-reading their config by themselves
+	OnChangeSignal OnChange = "signal"
+)
+
+// Runner runs a command with the fetched environment and reacts to changes of it
+type Runner struct {
+	Command []string
+	// Fetch returns the variables to add to the environment of the command
+	Fetch func(ctx context.Context) ([]string, error)
+	// Interval between checks for changed values, changes are not watched when zero
+	Interval time.Duration
+	OnChange OnChange
+	Signal   os.Signal
+	// StopTimeout is how long a restarted child may take to exit before it is killed
+	StopTimeout time.Duration
+	Logf        func(format string, args ...any)
+}
+
+func (r *Runner) start(env []string) (*exec.Cmd, <-chan error, error) {
+	cmd := exec.Command(r.Command[0], r.Command[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	return cmd, done, nil
+}
+
+// Run starts the command and returns its exit code once it exits without being restarted
+func (r *Runner) Run(ctx context.Context) (int, error) {
+	if len(r.Command) == 0 {
+		return 0, errors.New("no command given")
+	}
+	env, err := r.Fetch(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("fail to fetch environment: %w", err)
+	}
+	cmd, done, err := r.start(env)
+	if err != nil {
+		return 0, err
+	}
+
+	// signals received by dendrite are forwarded, so the child can shut down gracefully
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	var tick <-chan time.Time
+	if r.Interval > 0 {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var kill <-chan time.Time
+	restarting := false
+	for {
+		select {
+		case err := <-done:
+			if restarting {
+				restarting = false
+				kill = nil
+				r.Logf("restarting %s with the changed environment", r.Command[0])
+				cmd, done, err = r.start(env)
+				if err != nil {
+					return 0, err
+				}
+				continue
+			}
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return exitErr.ExitCode(), nil
+			}
+			return 0, err
+		case sig := <-signals:
+			// the child exits on its own, its exit code is returned once it does
+			restarting = false
+			_ = cmd.Process.Signal(sig)
+		case <-kill:
+			r.Logf("%s did not stop within %v, killing it", r.Command[0], r.StopTimeout)
+			_ = cmd.Process.Kill()
+		case <-tick:
+			if restarting {
+				continue
+			}
+			changed, err := r.Fetch(ctx)
+			if err != nil {
+				r.Logf("fail to fetch environment: %v", err)
+				continue
+			}
+			if reflect.DeepEqual(changed, env) {
+				continue
+			}
+			env = changed
+			switch r.OnChange {
+			case OnChangeRestart:
+				restarting = true
+				if r.StopTimeout > 0 {
+					kill = time.After(r.StopTimeout)
+				}
+				_ = cmd.Process.Signal(syscall.SIGTERM)
+			case OnChangeSignal:
+				r.Logf("environment changed, sending %v to %s", r.Signal, r.Command[0])
+				_ = cmd.Process.Signal(r.Signal)
+			}
+		}
+	}
+}
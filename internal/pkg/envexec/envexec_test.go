@@ -0,0 +1,70 @@
+package envexec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRules_Environ(t *testing.T) {
+	values := map[string][]string{
+		"/services/foo":                {"ignored"},
+		"/services/foo/port":           {"8080"},
+		"/services/foo/db/host-name":   {"localhost"},
+		"/services/foo/allowed.origin": {"a", "b"},
+	}
+	tests := []struct {
+		name  string
+		rules Rules
+		want  []string
+	}{
+		{
+			name:  "should upper case the relative path",
+			rules: Rules{Separator: ","},
+			want:  []string{"ALLOWED_ORIGIN=a,b", "DB_HOST_NAME=localhost", "PORT=8080"},
+		},
+		{
+			name:  "should apply the prefix and keep the case",
+			rules: Rules{Prefix: "APP_", Separator: " ", KeepCase: true},
+			want:  []string{"APP_allowed_origin=a b", "APP_db_host_name=localhost", "APP_port=8080"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rules.Environ("/services/foo/", values)
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Rules.Environ() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRules_EnvironErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  Rules
+		values map[string][]string
+	}{
+		{
+			name:   "should reject paths mapping to the same name",
+			values: map[string][]string{"/a-b": {"1"}, "/a_b": {"2"}},
+		},
+		{
+			name:   "should reject paths mapping to the same name once upper cased",
+			values: map[string][]string{"/a": {"1"}, "/A": {"2"}},
+		},
+		{
+			name:   "should reject names starting with a digit",
+			values: map[string][]string{"/1port": {"1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.rules.Environ("/", tt.values); err == nil {
+				t.Errorf("Rules.Environ() = %v, want an error", got)
+			}
+		})
+	}
+	if got, err := (Rules{Prefix: "APP_"}).Environ("/", map[string][]string{"/1port": {"1"}}); err != nil || !reflect.DeepEqual(got, []string{"APP_1PORT=1"}) {
+		t.Errorf("Rules.Environ() = %v, %v, want the prefixed name", got, err)
+	}
+}
@@ -0,0 +1,98 @@
+package envexec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// changingFetch returns V=1 until the file ready exists, V=2 afterwards
+func changingFetch(ready string) func(context.Context) ([]string, error) {
+	return func(context.Context) ([]string, error) {
+		if _, err := os.Stat(ready); err == nil {
+			return []string{"V=2"}, nil
+		}
+		return []string{"V=1"}, nil
+	}
+}
+
+func TestRunner_Run(t *testing.T) {
+	ctx := context.Background()
+	logf := func(format string, args ...any) {
+		t.Logf(format, args...)
+	}
+
+	t.Run("should return the exit code of the command", func(t *testing.T) {
+		runner := &Runner{
+			Command: []string{"sh", "-c", "exit 3"},
+			Fetch:   changingFetch(filepath.Join(t.TempDir(), "ready")),
+			Logf:    logf,
+		}
+		if code, err := runner.Run(ctx); err != nil || code != 3 {
+			t.Errorf("Runner.Run() = %d, %v, want 3", code, err)
+		}
+	})
+
+	t.Run("should restart the command when the environment changes", func(t *testing.T) {
+		dir := t.TempDir()
+		ready, output := filepath.Join(dir, "ready"), filepath.Join(dir, "output")
+		runner := &Runner{
+			Command:  []string{"sh", "-c", `echo "$V" >> "$0"; [ "$V" = 2 ] && exit 0; touch "$1"; exec sleep 10`, output, ready},
+			Fetch:    changingFetch(ready),
+			Interval: 5 * time.Millisecond,
+			OnChange: OnChangeRestart,
+			// sleep exits on SIGTERM, so the command is never killed
+			StopTimeout: 10 * time.Second,
+			Logf:        logf,
+		}
+		if code, err := runner.Run(ctx); err != nil || code != 0 {
+			t.Errorf("Runner.Run() = %d, %v, want 0", code, err)
+		}
+		if data, _ := os.ReadFile(output); string(data) != "1\n2\n" {
+			t.Errorf("environments = %q, want 1 then 2", data)
+		}
+	})
+
+	t.Run("should send the signal when the environment changes", func(t *testing.T) {
+		dir := t.TempDir()
+		ready := filepath.Join(dir, "ready")
+		runner := &Runner{
+			Command:  []string{"sh", "-c", `trap 'exit 5' HUP; touch "$0"; while true; do sleep 0.01; done`, ready},
+			Fetch:    changingFetch(ready),
+			Interval: 5 * time.Millisecond,
+			OnChange: OnChangeSignal,
+			Signal:   syscall.SIGHUP,
+			Logf:     logf,
+		}
+		if code, err := runner.Run(ctx); err != nil || code != 5 {
+			t.Errorf("Runner.Run() = %d, %v, want 5 from the trap", code, err)
+		}
+	})
+
+	t.Run("should kill a command which does not stop within the stop timeout", func(t *testing.T) {
+		dir := t.TempDir()
+		ready := filepath.Join(dir, "ready")
+		var logs []string
+		runner := &Runner{
+			Command:     []string{"sh", "-c", `[ "$V" = 2 ] && exit 7; trap '' TERM; touch "$0"; while true; do sleep 0.01; done`, ready},
+			Fetch:       changingFetch(ready),
+			Interval:    5 * time.Millisecond,
+			OnChange:    OnChangeRestart,
+			StopTimeout: 50 * time.Millisecond,
+			Logf: func(format string, args ...any) {
+				logf(format, args...)
+				logs = append(logs, format)
+			},
+		}
+		if code, err := runner.Run(ctx); err != nil || code != 7 {
+			t.Errorf("Runner.Run() = %d, %v, want 7 from the restarted command", code, err)
+		}
+		if !strings.Contains(strings.Join(logs, "\n"), "killing") {
+			t.Errorf("logs = %q, want the kill to be logged", logs)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+)
+
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Step is a single change required to make the server match the declared tree
+type Step struct {
+	Action Action
+	Path   string
+	// Before holds the current values on the server, empty for created paths
+	Before []string
+	// After holds the declared values, empty for deleted paths
+	After []string
+}
+
+// Plan is the ordered list of steps turning the current server state into the declared one
+type Plan struct {
+	Steps []Step
+}
+
+// NewPlan compares the declared state with the current values in the backend.
+// Paths under any of the prune prefixes which exist in the backend but are not declared are planned for deletion.
+func NewPlan(ctx context.Context, b backend.Backend, desired State, prunePrefixes []string) (*Plan, error) {
+	plan := &Plan{}
+	for _, p := range desired.Paths() {
+		current, err := b.GetManyCurrent(ctx, p)
+		var notFoundErr *backend.NotFoundErr
+		if err != nil && !errors.As(err, &notFoundErr) {
+			return nil, fmt.Errorf("failed to get current values of %s: %w", p, err)
+		}
+		switch {
+		case len(current) == 0:
+			plan.Steps = append(plan.Steps, Step{Action: ActionCreate, Path: p, After: desired[p]})
+		case !equal(current, desired[p]):
+			plan.Steps = append(plan.Steps, Step{Action: ActionUpdate, Path: p, Before: current, After: desired[p]})
+		}
+	}
+
+	pruned := map[string]bool{}
+	for _, prefix := range prunePrefixes {
+		existing, err := b.List(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list paths under %s: %w", prefix, err)
+		}
+		for _, metadata := range existing {
+			if _, ok := desired[metadata.Path]; ok || pruned[metadata.Path] {
+				continue
+			}
+			current, err := b.GetManyCurrent(ctx, metadata.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get current values of %s: %w", metadata.Path, err)
+			}
+			pruned[metadata.Path] = true
+			plan.Steps = append(plan.Steps, Step{Action: ActionDelete, Path: metadata.Path, Before: current})
+		}
+	}
+	return plan, nil
+}
+
+// Changes converts the plan into backend changes
+func (p *Plan) Changes() []backend.Change {
+	changes := make([]backend.Change, 0, len(p.Steps))
+	for _, step := range p.Steps {
+		changes = append(changes, backend.Change{
+			Path:   step.Path,
+			Values: step.After,
+			Delete: step.Action == ActionDelete,
+		})
+	}
+	return changes
+}
+
+// Apply executes every step of the plan in a single batch, so either all or none of them take effect
+func (p *Plan) Apply(ctx context.Context, b backend.Backend) ([]backend.Metadata, error) {
+	if len(p.Steps) == 0 {
+		return []backend.Metadata{}, nil
+	}
+	return b.Batch(ctx, p.Changes())
+}
+
+// Count returns the number of steps with the given action
+func (p *Plan) Count(action Action) int {
+	count := 0
+	for _, step := range p.Steps {
+		if step.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// Write prints the plan as a human readable diff
+func (p *Plan) Write(w io.Writer) error {
+	if len(p.Steps) == 0 {
+		_, err := fmt.Fprintln(w, "No changes. The declared tree matches the server.")
+		return err
+	}
+	for _, step := range p.Steps {
+		var err error
+		switch step.Action {
+		case ActionCreate:
+			_, err = fmt.Fprintf(w, "+ %s = %s\n", step.Path, format(step.After))
+		case ActionUpdate:
+			_, err = fmt.Fprintf(w, "~ %s = %s -> %s\n", step.Path, format(step.Before), format(step.After))
+		case ActionDelete:
+			_, err = fmt.Fprintf(w, "- %s = %s\n", step.Path, format(step.Before))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d to delete.\n", p.Count(ActionCreate), p.Count(ActionUpdate), p.Count(ActionDelete))
+	return err
+}
+
+func format(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, strconv.Quote(value))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
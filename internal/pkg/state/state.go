@@ -0,0 +1,165 @@
+package state
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// State is a declared config tree, mapping every declared path to its values
+//
+// It is read from YAML files where nested mapping keys are joined into paths, scalars declare a single value
+// and sequences of scalars declare multiple values, e.g.
+//
+//	services:
+//	  foo:
+//	    port: 8080
+//	    hosts: [a, b]
+//	/services/bar/port: 9090
+//
+// declares /services/foo/port, /services/foo/hosts and /services/bar/port.
+// A path which is both a leaf and a parent is declared by spelling out both paths as keys.
+type State map[string][]string
+
+// Paths returns the declared paths in lexical order
+func (s State) Paths() []string {
+	paths := make([]string, 0, len(s))
+	for p := range s {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Validate checks that every path is a clean absolute path declaring at least one value
+func (s State) Validate() error {
+	for p, values := range s {
+		if !strings.HasPrefix(p, "/") || path.Clean(p) != p || p == "/" {
+			return fmt.Errorf("invalid path %q", p)
+		}
+		if len(values) == 0 {
+			return fmt.Errorf("path %s declares no values", p)
+		}
+	}
+	return nil
+}
+
+// Load reads the declared tree from the given files and directories, directories are walked for *.yaml and *.yml files
+func Load(names ...string) (State, error) {
+	state := State{}
+	for _, name := range names {
+		err := filepath.WalkDir(name, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			// files passed explicitly are always read, whatever their extension is
+			if file != name && filepath.Ext(file) != ".yaml" && filepath.Ext(file) != ".yml" {
+				return nil
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			if err := state.Parse(data); err != nil {
+				return fmt.Errorf("invalid declaration in %s: %w", file, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// Parse adds the paths declared in a YAML document to the state
+func (s State) Parse(data []byte) error {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	// an empty document declares nothing
+	if len(document.Content) == 0 {
+		return nil
+	}
+	return s.add("/", document.Content[0])
+}
+
+func (s State) add(base string, node *yaml.Node) error {
+	node = resolve(node)
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping under %s", node.Line, base)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, child := resolve(node.Content[i]), resolve(node.Content[i+1])
+		p := path.Join(base, key.Value)
+		if key.Kind != yaml.ScalarNode || strings.TrimSpace(key.Value) == "" || p == "/" {
+			return fmt.Errorf("line %d: invalid key under %s", key.Line, base)
+		}
+		switch child.Kind {
+		case yaml.MappingNode:
+			if err := s.add(p, child); err != nil {
+				return err
+			}
+		case yaml.SequenceNode:
+			if len(child.Content) == 0 {
+				return fmt.Errorf("line %d: path %s declares no values", child.Line, p)
+			}
+			values := make([]string, 0, len(child.Content))
+			for _, item := range child.Content {
+				value, err := scalar(p, resolve(item))
+				if err != nil {
+					return err
+				}
+				values = append(values, value)
+			}
+			if err := s.declare(p, values); err != nil {
+				return err
+			}
+		default:
+			value, err := scalar(p, child)
+			if err != nil {
+				return err
+			}
+			if err := s.declare(p, []string{value}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s State) declare(p string, values []string) error {
+	if _, ok := s[p]; ok {
+		return fmt.Errorf("path %s is declared more than once", p)
+	}
+	s[p] = values
+	return nil
+}
+
+// scalar returns the literal text of a scalar node, so that values like 010 or 1.50 are kept as written
+func scalar(p string, node *yaml.Node) (string, error) {
+	if node.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("line %d: path %s declares a nested value inside a list", node.Line, p)
+	}
+	if node.Tag == "!!null" {
+		return "", fmt.Errorf("line %d: path %s declares a null value", node.Line, p)
+	}
+	return node.Value, nil
+}
+
+func resolve(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
@@ -0,0 +1,133 @@
+package state
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	backendmock "github.com/laminatedio/dendrite/mocks/internal_/pkg/backend"
+)
+
+func TestState_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    State
+		wantErr bool
+	}{
+		{
+			name: "should join nested keys into paths",
+			data: `
+A:
+  B:
+    C: 1
+    D: [x, "y"]
+/A/B: [C, D]
+E: 010
+`,
+			want: State{
+				"/A/B/C": {"1"},
+				"/A/B/D": {"x", "y"},
+				"/A/B":   {"C", "D"},
+				"/E":     {"010"},
+			},
+		},
+		{
+			name: "should declare nothing for an empty document",
+			data: ``,
+			want: State{},
+		},
+		{
+			name:    "should reject paths declared twice",
+			data:    "A:\n  B: 1\n/A/B: 2\n",
+			wantErr: true,
+		},
+		{
+			name:    "should reject null values",
+			data:    "A: null\n",
+			wantErr: true,
+		},
+		{
+			name:    "should reject empty lists",
+			data:    "A: []\n",
+			wantErr: true,
+		},
+		{
+			name:    "should reject nested values inside a list",
+			data:    "A: [{B: 1}]\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := State{}
+			err := got.Parse([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("State.Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("State.Parse() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	ctx := context.Background()
+	mock := &backendmock.Backend{}
+	mock.On("GetManyCurrent", ctx, "/A/B").Return([]string{"C", "D"}, nil)
+	mock.On("GetManyCurrent", ctx, "/A/B/C").Return([]string{"1"}, nil)
+	mock.On("GetManyCurrent", ctx, "/A/B/D").Return([]string{}, nil)
+	mock.On("GetManyCurrent", ctx, "/A/B/E").Return([]string{"3"}, nil)
+	mock.On("GetManyCurrent", ctx, "/F").Return(nil, &backend.NotFoundErr{Path: "/F"})
+	mock.On("List", ctx, "/A").Return([]backend.Metadata{
+		{Path: "/A/B"},
+		{Path: "/A/B/C"},
+		{Path: "/A/B/E"},
+	}, nil)
+
+	desired := State{
+		"/A/B":   {"C", "D"},
+		"/A/B/C": {"2"},
+		"/A/B/D": {"2"},
+		"/F":     {"4", "5"},
+	}
+	tests := []struct {
+		name          string
+		prunePrefixes []string
+		want          []Step
+	}{
+		{
+			name: "should create and update paths",
+			want: []Step{
+				{Action: ActionUpdate, Path: "/A/B/C", Before: []string{"1"}, After: []string{"2"}},
+				{Action: ActionCreate, Path: "/A/B/D", After: []string{"2"}},
+				{Action: ActionCreate, Path: "/F", After: []string{"4", "5"}},
+			},
+		},
+		{
+			name:          "should delete undeclared paths under managed prefixes",
+			prunePrefixes: []string{"/A"},
+			want: []Step{
+				{Action: ActionUpdate, Path: "/A/B/C", Before: []string{"1"}, After: []string{"2"}},
+				{Action: ActionCreate, Path: "/A/B/D", After: []string{"2"}},
+				{Action: ActionCreate, Path: "/F", After: []string{"4", "5"}},
+				{Action: ActionDelete, Path: "/A/B/E", Before: []string{"3"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewPlan(ctx, mock, desired, tt.prunePrefixes)
+			if err != nil {
+				t.Errorf("NewPlan() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got.Steps, tt.want) {
+				t.Errorf("NewPlan() = %#v, want %#v", got.Steps, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type CacheConfig struct {
+	// File keeps the last successful responses across restarts, nothing is persisted when empty
+	File string
+	// RefreshInterval is how often cached responses are fetched again in the background.
+	// When set reads are served from memory and only the first read of a request goes to the server,
+	// otherwise every read goes to the server and the cache is only used when the server is unavailable.
+	RefreshInterval time.Duration
+	// OnRefreshError is called with errors of background refreshes and of persisting the file
+	OnRefreshError func(err error)
+}
+
+type cacheEntry struct {
+	Route     string          `json:"route"`
+	Input     json.RawMessage `json:"input"`
+	Response  json.RawMessage `json:"response"`
+	FetchedAt time.Time       `json:"fetchedAt"`
+}
+
+// Cache serves the reads of a client from the last known good responses.
+//
+// Successful responses are kept in memory and persisted to a file, so a service can start with the
+// config it last saw even when the dendrite server or its database is down. Cached responses are served
+// whenever the server cannot be reached or fails with a 5xx status, not found and other client errors are
+// returned as is. A response which is no longer found is evicted, so a deleted path is not served later.
+type Cache struct {
+	client *Client
+	config CacheConfig
+
+	mutex   sync.RWMutex
+	entries map[string]cacheEntry
+	// persistMutex orders the writes of the file, so an older snapshot is never renamed over a newer one
+	persistMutex sync.Mutex
+	stop         chan struct{}
+	stopped      sync.WaitGroup
+}
+
+// NewCache wraps the client with a cache, loading the responses persisted by a previous run.
+// Close must be called to stop the background refresh.
+func NewCache(client *Client, config CacheConfig) (*Cache, error) {
+	c := &Cache{
+		client:  client,
+		config:  config,
+		entries: map[string]cacheEntry{},
+		stop:    make(chan struct{}),
+	}
+	if config.OnRefreshError == nil {
+		c.config.OnRefreshError = func(error) {}
+	}
+	if config.File != "" {
+		data, err := os.ReadFile(config.File)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &c.entries); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if config.RefreshInterval > 0 {
+		c.stopped.Add(1)
+		go c.refreshLoop()
+	}
+	return c, nil
+}
+
+// Close stops the background refresh
+func (c *Cache) Close() error {
+	close(c.stop)
+	c.stopped.Wait()
+	return nil
+}
+
+// unavailable reports whether err means the server could not answer, rather than answering with an error
+func unavailable(err error) bool {
+	if IsNotFound(err) {
+		return false
+	}
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.StatusCode >= 500
+	}
+	var decodeErr *decodeError
+	return !errors.As(err, &decodeErr)
+}
+
+func (c *Cache) lookup(key string) (cacheEntry, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+func (c *Cache) fetch(ctx context.Context, route string, input json.RawMessage) ([]byte, error) {
+	key := route + "\x00" + string(input)
+	data, err := c.client.do(ctx, route, input, false)
+	if IsNotFound(err) {
+		c.evict(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	previous, ok := c.entries[key]
+	c.entries[key] = cacheEntry{
+		Route:     route,
+		Input:     input,
+		Response:  data,
+		FetchedAt: time.Now(),
+	}
+	c.mutex.Unlock()
+	if !ok || string(previous.Response) != string(data) {
+		if err := c.persist(); err != nil {
+			c.config.OnRefreshError(err)
+		}
+	}
+	return data, nil
+}
+
+// evict drops the entry of a request which is no longer found, so it is not served when the server is unavailable
+func (c *Cache) evict(key string) {
+	c.mutex.Lock()
+	_, ok := c.entries[key]
+	delete(c.entries, key)
+	c.mutex.Unlock()
+	if ok {
+		if err := c.persist(); err != nil {
+			c.config.OnRefreshError(err)
+		}
+	}
+}
+
+func (c *Cache) post(ctx context.Context, route string, input any, output any) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	key := route + "\x00" + string(body)
+	entry, cached := c.lookup(key)
+	if cached && c.config.RefreshInterval > 0 {
+		return decode(entry.Response, output)
+	}
+	data, err := c.fetch(ctx, route, body)
+	if err != nil {
+		if cached && unavailable(err) {
+			return decode(entry.Response, output)
+		}
+		return err
+	}
+	return decode(data, output)
+}
+
+// persist writes the entries to a temporary file renamed over the cache file, so a crash never leaves a partial file
+func (c *Cache) persist() error {
+	if c.config.File == "" {
+		return nil
+	}
+	c.persistMutex.Lock()
+	defer c.persistMutex.Unlock()
+	c.mutex.RLock()
+	data, err := json.Marshal(c.entries)
+	c.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(c.config.File), "."+filepath.Base(c.config.File)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), c.config.File)
+}
+
+// Refresh fetches every cached response again, entries are kept when the server is unavailable
+// and dropped when their path or version is no longer found
+func (c *Cache) Refresh(ctx context.Context) error {
+	c.mutex.RLock()
+	entries := make([]cacheEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+	c.mutex.RUnlock()
+	var failed error
+	for _, entry := range entries {
+		if _, err := c.fetch(ctx, entry.Route, entry.Input); err != nil && !IsNotFound(err) {
+			failed = err
+		}
+	}
+	return failed
+}
+
+func (c *Cache) refreshLoop() {
+	defer c.stopped.Done()
+	ticker := time.NewTicker(c.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), c.config.RefreshInterval)
+			if err := c.Refresh(ctx); err != nil {
+				c.config.OnRefreshError(err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Query runs a GraphQL query and returns the nested object of the selected values
+func (c *Cache) Query(ctx context.Context, query string) (map[string]any, error) {
+	output := map[string]any{}
+	if err := c.QueryInto(ctx, query, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// QueryInto runs a GraphQL query and decodes the result into output like Client.QueryInto
+func (c *Cache) QueryInto(ctx context.Context, query string, output any) error {
+	var response queryResponse
+	if err := c.post(ctx, "/query", map[string]string{"query": query}, &response); err != nil {
+		return err
+	}
+	return decode(response.Data, output)
+}
+
+func (c *Cache) GetCurrent(ctx context.Context, path string) (string, error) {
+	var output struct {
+		Value string `json:"value"`
+	}
+	if err := c.post(ctx, "/getCurrent", map[string]any{"path": path}, &output); err != nil {
+		return "", err
+	}
+	return output.Value, nil
+}
+
+func (c *Cache) Get(ctx context.Context, path string, version int) (string, error) {
+	var output struct {
+		Value string `json:"value"`
+	}
+	if err := c.post(ctx, "/get", map[string]any{"path": path, "version": version}, &output); err != nil {
+		return "", err
+	}
+	return output.Value, nil
+}
+
+func (c *Cache) GetManyCurrent(ctx context.Context, path string) ([]string, error) {
+	var output struct {
+		Values []string `json:"values"`
+	}
+	if err := c.post(ctx, "/getManyCurrent", map[string]any{"path": path}, &output); err != nil {
+		return nil, err
+	}
+	return output.Values, nil
+}
+
+func (c *Cache) GetMany(ctx context.Context, path string, version int) ([]string, error) {
+	var output struct {
+		Values []string `json:"values"`
+	}
+	if err := c.post(ctx, "/getMany", map[string]any{"path": path, "version": version}, &output); err != nil {
+		return nil, err
+	}
+	return output.Values, nil
+}
+
+// Export returns the current values of prefix and every path below it
+func (c *Cache) Export(ctx context.Context, prefix string) (map[string][]string, error) {
+	output := map[string][]string{}
+	if err := c.post(ctx, "/export", map[string]any{"prefix": prefix}, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
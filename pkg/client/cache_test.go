@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var down, deleted int32
+	var value atomic.Value
+	value.Store("1")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case atomic.LoadInt32(&down) == 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.URL.Path == "/v1/getCurrent" && atomic.LoadInt32(&deleted) == 0:
+			w.Write([]byte(`{"value": "` + value.Load().(string) + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "path /B not found"}`))
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "cache.json")
+	c := New(Config{Endpoint: server.URL})
+
+	cache, err := NewCache(c, CacheConfig{File: file})
+	if err != nil {
+		t.Fatalf("NewCache() error = %v", err)
+	}
+	if got, err := cache.GetCurrent(ctx, "/A"); err != nil || got != "1" {
+		t.Errorf("Cache.GetCurrent() = %v, %v, want 1", got, err)
+	}
+	if _, err := cache.GetManyCurrent(ctx, "/B"); !IsNotFound(err) {
+		t.Errorf("Cache.GetManyCurrent() error = %v, want not found", err)
+	}
+	cache.Close()
+
+	t.Run("should serve the persisted responses when the server is down", func(t *testing.T) {
+		atomic.StoreInt32(&down, 1)
+		defer atomic.StoreInt32(&down, 0)
+		cache, err := NewCache(c, CacheConfig{File: file})
+		if err != nil {
+			t.Fatalf("NewCache() error = %v", err)
+		}
+		defer cache.Close()
+		if got, err := cache.GetCurrent(ctx, "/A"); err != nil || got != "1" {
+			t.Errorf("Cache.GetCurrent() = %v, %v, want 1", got, err)
+		}
+		if _, err := cache.GetCurrent(ctx, "/uncached"); err == nil {
+			t.Errorf("Cache.GetCurrent() error = nil for an uncached path")
+		}
+	})
+
+	t.Run("should serve from memory until refreshed", func(t *testing.T) {
+		cache, err := NewCache(c, CacheConfig{File: file, RefreshInterval: time.Hour})
+		if err != nil {
+			t.Fatalf("NewCache() error = %v", err)
+		}
+		defer cache.Close()
+		value.Store("2")
+		if got, _ := cache.GetCurrent(ctx, "/A"); got != "1" {
+			t.Errorf("Cache.GetCurrent() = %v before refresh, want 1", got)
+		}
+		if err := cache.Refresh(ctx); err != nil {
+			t.Errorf("Cache.Refresh() error = %v", err)
+		}
+		if got, _ := cache.GetCurrent(ctx, "/A"); got != "2" {
+			t.Errorf("Cache.GetCurrent() = %v after refresh, want 2", got)
+		}
+	})
+
+	t.Run("should persist every entry of concurrent reads", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "cache.json")
+		cache, err := NewCache(c, CacheConfig{File: file})
+		if err != nil {
+			t.Fatalf("NewCache() error = %v", err)
+		}
+		defer cache.Close()
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				cache.GetCurrent(ctx, fmt.Sprintf("/concurrent/%d", i))
+			}(i)
+		}
+		wg.Wait()
+		persisted, err := NewCache(c, CacheConfig{File: file})
+		if err != nil {
+			t.Fatalf("NewCache() error = %v", err)
+		}
+		defer persisted.Close()
+		if got := len(persisted.entries); got != 50 {
+			t.Errorf("persisted %d entries, want 50", got)
+		}
+	})
+	t.Run("should stop serving a path deleted on the server", func(t *testing.T) {
+		cache, err := NewCache(c, CacheConfig{File: file, RefreshInterval: time.Hour})
+		if err != nil {
+			t.Fatalf("NewCache() error = %v", err)
+		}
+		defer cache.Close()
+		atomic.StoreInt32(&deleted, 1)
+		if err := cache.Refresh(ctx); err != nil {
+			t.Errorf("Cache.Refresh() error = %v", err)
+		}
+		atomic.StoreInt32(&down, 1)
+		defer atomic.StoreInt32(&down, 0)
+		if _, err := cache.GetCurrent(ctx, "/A"); err == nil {
+			t.Errorf("Cache.GetCurrent() error = nil for a deleted path")
+		}
+		persisted, err := NewCache(c, CacheConfig{File: file})
+		if err != nil {
+			t.Fatalf("NewCache() error = %v", err)
+		}
+		defer persisted.Close()
+		if _, err := persisted.GetCurrent(ctx, "/A"); err == nil {
+			t.Errorf("Cache.GetCurrent() error = nil for a deleted path after restart")
+		}
+	})
+}
@@ -0,0 +1,321 @@
+// Package client is the Go SDK of the dendrite HTTP API.
+//
+//	c := client.New(client.Config{Endpoint: "http://dendrite:8080"})
+//	port, err := c.GetCurrent(ctx, "/services/foo/port")
+//	if client.IsNotFound(err) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// Endpoint is the base URL of the dendrite server, e.g. http://localhost:8080
+	Endpoint string
+	// Token is sent as a bearer token when set
+	Token string
+	// UserName and Password are sent as basic auth credentials when UserName is set
+	UserName string
+	Password string
+	// HTTPClient sends the requests, http.DefaultClient is used when nil
+	HTTPClient *http.Client
+	// MaxRetries is the number of times a failed request is retried, on network errors and 502, 503 or 504 responses
+	MaxRetries int
+	// RetryWait is the wait before the first retry, doubled on each following one, 100ms when zero
+	RetryWait time.Duration
+	// RetryWrites allows Set and SetMany to be retried as well.
+	// A retried write may create a duplicated version when the server applied the first attempt but failed to respond.
+	RetryWrites bool
+}
+
+// Metadata describes the versions of a path
+type Metadata struct {
+	Path           string
+	LatestVersion  int
+	CurrentVersion int
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	// Revision is the global revision of the write of the latest version
+	Revision int
+}
+
+type Version struct {
+	Version int      `json:"version"`
+	Values  []string `json:"values"`
+}
+
+type History struct {
+	Metadata Metadata `json:"metadata"`
+	// Versions are ordered from the latest to the oldest
+	Versions []Version `json:"versions"`
+}
+
+// NotFoundError is returned when the requested path or version does not exist
+type NotFoundError struct {
+	Message string
+}
+
+func (err *NotFoundError) Error() string {
+	return err.Message
+}
+
+// ServerError is returned when the server responds with any other non 2xx status code
+type ServerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *ServerError) Error() string {
+	return fmt.Sprintf("server responded with %d: %s", err.StatusCode, err.Message)
+}
+
+// IsNotFound reports whether err is caused by a missing path or version
+func IsNotFound(err error) bool {
+	var notFoundErr *NotFoundError
+	return errors.As(err, &notFoundErr)
+}
+
+// Client talks to a dendrite server over its HTTP API, it is safe for concurrent use
+type Client struct {
+	config Config
+}
+
+func New(config Config) *Client {
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.RetryWait <= 0 {
+		config.RetryWait = 100 * time.Millisecond
+	}
+	return &Client{
+		config: config,
+	}
+}
+
+// retryable reports whether a failed attempt may succeed when it is sent again,
+// which are network errors and the 502, 503 and 504 responses of proxies and overloaded servers
+func retryable(err error) bool {
+	var notFoundErr *NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return false
+	}
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.StatusCode == http.StatusBadGateway ||
+			serverErr.StatusCode == http.StatusServiceUnavailable ||
+			serverErr.StatusCode == http.StatusGatewayTimeout
+	}
+	// the response was received but could not be read or decoded, sending it again will not help
+	var decodeErr *decodeError
+	return !errors.As(err, &decodeErr)
+}
+
+type decodeError struct {
+	err error
+}
+
+func (err *decodeError) Error() string {
+	return fmt.Sprintf("failed to decode response: %v", err.err)
+}
+
+func (err *decodeError) Unwrap() error {
+	return err.err
+}
+
+func (c *Client) post(ctx context.Context, route string, input any, output any, write bool) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	data, err := c.do(ctx, route, body, write)
+	if err != nil {
+		return err
+	}
+	return decode(data, output)
+}
+
+// queryResponse is the response of a GraphQL request, failed requests are reported in the errors
+type queryResponse struct {
+	Data json.RawMessage `json:"data"`
+}
+
+func decode(data []byte, output any) error {
+	if err := json.Unmarshal(data, output); err != nil {
+		return &decodeError{err}
+	}
+	return nil
+}
+
+// do sends the request body to the route, retrying as configured, and returns the raw body of the response
+func (c *Client) do(ctx context.Context, route string, body []byte, write bool) ([]byte, error) {
+	wait := c.config.RetryWait
+	for attempt := 0; ; attempt++ {
+		data, err := c.send(ctx, route, body)
+		if err == nil || ctx.Err() != nil || attempt >= c.config.MaxRetries || (write && !c.config.RetryWrites) || !retryable(err) {
+			return data, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, route string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.Endpoint+"/v1"+route, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	} else if c.config.UserName != "" {
+		req.SetBasicAuth(c.config.UserName, c.config.Password)
+	}
+
+	res, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, &decodeError{err}
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		var e struct {
+			Message string `json:"message"`
+			Errors  []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Message == "" && len(e.Errors) > 0 {
+			e.Message = e.Errors[0].Message
+		}
+		if e.Message == "" {
+			e.Message = http.StatusText(res.StatusCode)
+		}
+		if res.StatusCode == http.StatusNotFound {
+			return nil, &NotFoundError{Message: e.Message}
+		}
+		return nil, &ServerError{StatusCode: res.StatusCode, Message: e.Message}
+	}
+	return data, nil
+}
+
+// Query runs a GraphQL query and returns the nested object of the selected values
+func (c *Client) Query(ctx context.Context, query string) (map[string]any, error) {
+	output := map[string]any{}
+	if err := c.QueryInto(ctx, query, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// QueryInto runs a GraphQL query and decodes the result into output, which is decoded like a JSON response, e.g.
+//
+//	var config struct {
+//		Services struct {
+//			Foo struct {
+//				Port  string   `json:"port"`
+//				Hosts []string `json:"hosts"`
+//			} `json:"foo"`
+//		} `json:"services"`
+//	}
+//	err := c.QueryInto(ctx, `{ services { foo { port hosts } } }`, &config)
+func (c *Client) QueryInto(ctx context.Context, query string, output any) error {
+	var response queryResponse
+	if err := c.post(ctx, "/query", map[string]string{"query": query}, &response, false); err != nil {
+		return err
+	}
+	return decode(response.Data, output)
+}
+
+func (c *Client) GetCurrent(ctx context.Context, path string) (string, error) {
+	var output struct {
+		Value string `json:"value"`
+	}
+	if err := c.post(ctx, "/getCurrent", map[string]any{"path": path}, &output, false); err != nil {
+		return "", err
+	}
+	return output.Value, nil
+}
+
+func (c *Client) Get(ctx context.Context, path string, version int) (string, error) {
+	var output struct {
+		Value string `json:"value"`
+	}
+	if err := c.post(ctx, "/get", map[string]any{"path": path, "version": version}, &output, false); err != nil {
+		return "", err
+	}
+	return output.Value, nil
+}
+
+func (c *Client) GetManyCurrent(ctx context.Context, path string) ([]string, error) {
+	var output struct {
+		Values []string `json:"values"`
+	}
+	if err := c.post(ctx, "/getManyCurrent", map[string]any{"path": path}, &output, false); err != nil {
+		return nil, err
+	}
+	return output.Values, nil
+}
+
+func (c *Client) GetMany(ctx context.Context, path string, version int) ([]string, error) {
+	var output struct {
+		Values []string `json:"values"`
+	}
+	if err := c.post(ctx, "/getMany", map[string]any{"path": path, "version": version}, &output, false); err != nil {
+		return nil, err
+	}
+	return output.Values, nil
+}
+
+// Set writes value as a new version of path, which becomes the current version unless keepCurrent is set
+func (c *Client) Set(ctx context.Context, path string, value string, keepCurrent bool) (*Metadata, error) {
+	output := &Metadata{}
+	if err := c.post(ctx, "/set", map[string]any{"path": path, "value": value, "keepCurrent": keepCurrent}, output, true); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// SetMany writes values as a new version of path, which becomes the current version unless keepCurrent is set
+func (c *Client) SetMany(ctx context.Context, path string, values []string, keepCurrent bool) (*Metadata, error) {
+	output := &Metadata{}
+	if err := c.post(ctx, "/setMany", map[string]any{"path": path, "values": values, "keepCurrent": keepCurrent}, output, true); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// History returns every version of path
+func (c *Client) History(ctx context.Context, path string) (*History, error) {
+	output := &History{}
+	if err := c.post(ctx, "/history", map[string]any{"path": path}, output, false); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// Export returns the current values of prefix and every path below it
+func (c *Client) Export(ctx context.Context, prefix string) (map[string][]string, error) {
+	output := map[string][]string{}
+	if err := c.post(ctx, "/export", map[string]any{"prefix": prefix}, &output, false); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
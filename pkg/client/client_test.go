@@ -0,0 +1,168 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/dendrite"
+	backendmock "github.com/laminatedio/dendrite/mocks/internal_/pkg/backend"
+)
+
+func newTestServer(b backend.Backend) *httptest.Server {
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	controller := dendrite.NewDendriteController(dendrite.NewDendriteService(b), zap.NewNop().Sugar(), &backend.Config{Type: "mock"}, &dendrite.SubscriptionConfig{Interval: time.Second})
+	controller.RegisterControllerRoutes(engine.Group("/v1" + controller.RoutePattern()))
+	return httptest.NewServer(engine)
+}
+
+func TestClient(t *testing.T) {
+	backendMock := &backendmock.Backend{}
+	backendMock.On("Revision", mock.Anything).Return(3, nil)
+	backendMock.On("GetCurrent", mock.Anything, "/A").Return("1", nil)
+	backendMock.On("GetCurrent", mock.Anything, "/B").Return("", &backend.NotFoundErr{Path: "/B"})
+	backendMock.On("GetMany", mock.Anything, "/A", 2).Return([]string{"1", "2"}, nil)
+	backendMock.On("GetManyPaths", mock.Anything, []backend.Selection{{Path: "/A/C", Version: -1}, {Path: "/E", Version: -1}}).Return([][]string{{"x", "y"}, {"1"}}, nil)
+	backendMock.On("SetMany", mock.Anything, "/A", []string{"3"}, backend.SetOptions{KeepCurrent: true}).Return(&backend.Metadata{Path: "/A", LatestVersion: 3, CurrentVersion: 2}, nil)
+	server := newTestServer(backendMock)
+	defer server.Close()
+
+	ctx := context.Background()
+	c := New(Config{Endpoint: server.URL + "/"})
+
+	t.Run("should get the current value", func(t *testing.T) {
+		got, err := c.GetCurrent(ctx, "/A")
+		if err != nil || got != "1" {
+			t.Errorf("Client.GetCurrent() = %v, %v, want 1", got, err)
+		}
+	})
+	t.Run("should return not found errors", func(t *testing.T) {
+		_, err := c.GetCurrent(ctx, "/B")
+		if !IsNotFound(err) || err.Error() != "path /B not found" {
+			t.Errorf("Client.GetCurrent() error = %#v, want not found", err)
+		}
+	})
+	t.Run("should get versioned values", func(t *testing.T) {
+		got, err := c.GetMany(ctx, "/A", 2)
+		if err != nil || !reflect.DeepEqual(got, []string{"1", "2"}) {
+			t.Errorf("Client.GetMany() = %v, %v, want [1 2]", got, err)
+		}
+	})
+	t.Run("should set values", func(t *testing.T) {
+		got, err := c.SetMany(ctx, "/A", []string{"3"}, true)
+		want := &Metadata{Path: "/A", LatestVersion: 3, CurrentVersion: 2}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Client.SetMany() = %#v, %v, want %#v", got, err, want)
+		}
+	})
+	t.Run("should decode query results into structs", func(t *testing.T) {
+		var got struct {
+			A struct {
+				C []string `json:"C"`
+			} `json:"A"`
+			E string `json:"E"`
+		}
+		err := c.QueryInto(ctx, `{ A { C } E }`, &got)
+		if err != nil || got.E != "1" || !reflect.DeepEqual(got.A.C, []string{"x", "y"}) {
+			t.Errorf("Client.QueryInto() = %#v, %v", got, err)
+		}
+	})
+}
+
+func TestClient_Retry(t *testing.T) {
+	var attempts, status int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(int(atomic.LoadInt32(&status)))
+			return
+		}
+		w.Write([]byte(`{"value": "1"}`))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		config       Config
+		status       int32
+		write        bool
+		wantAttempts int32
+		wantErr      bool
+	}{
+		{
+			name:         "should retry reads until they succeed",
+			config:       Config{MaxRetries: 3, RetryWait: time.Millisecond},
+			wantAttempts: 3,
+			wantErr:      false,
+		},
+		{
+			name:         "should give up after the retries",
+			config:       Config{MaxRetries: 1, RetryWait: time.Millisecond},
+			wantAttempts: 2,
+			wantErr:      true,
+		},
+		{
+			name:         "should not retry writes by default",
+			config:       Config{MaxRetries: 3, RetryWait: time.Millisecond},
+			write:        true,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "should not retry not found",
+			config:       Config{MaxRetries: 3, RetryWait: time.Millisecond},
+			status:       http.StatusNotFound,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "should not retry other client errors",
+			config:       Config{MaxRetries: 3, RetryWait: time.Millisecond},
+			status:       http.StatusBadRequest,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "should not retry internal server errors",
+			config:       Config{MaxRetries: 3, RetryWait: time.Millisecond},
+			status:       http.StatusInternalServerError,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&attempts, 0)
+			if tt.status == 0 {
+				tt.status = http.StatusServiceUnavailable
+			}
+			atomic.StoreInt32(&status, tt.status)
+			tt.config.Endpoint = server.URL
+			c := New(tt.config)
+			var err error
+			if tt.write {
+				_, err = c.Set(ctx, "/A", "1", false)
+			} else {
+				_, err = c.GetCurrent(ctx, "/A")
+			}
+			var serverErr *ServerError
+			if (err != nil) != tt.wantErr || (err != nil && !errors.As(err, &serverErr) && !IsNotFound(err)) {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(&attempts); got != tt.wantAttempts {
+				t.Errorf("sent %d attempts, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
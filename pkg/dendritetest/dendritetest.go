@@ -0,0 +1,38 @@
+// Package dendritetest starts in-memory dendrite servers for tests
+package dendritetest
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/laminatedio/dendrite/pkg/client"
+	"github.com/laminatedio/dendrite/pkg/server"
+)
+
+// Server is a dendrite server listening on a local port, backed by memory
+type Server struct {
+	*httptest.Server
+	Backend server.Backend
+	// Client is connected to the server
+	Client *client.Client
+}
+
+// NewServer starts a server seeded with version 1 of each path in seed, it is closed when the test finishes
+func NewServer(t testing.TB, seed map[string][]string) *Server {
+	t.Helper()
+	memory := server.NewMemoryBackend()
+	for path, values := range seed {
+		if _, err := memory.SetMany(context.Background(), path, values, server.SetOptions{}); err != nil {
+			t.Fatalf("fail to seed %s: %v", path, err)
+		}
+	}
+
+	s := &Server{
+		Server:  httptest.NewServer(server.New(memory, server.Options{})),
+		Backend: memory,
+	}
+	s.Client = client.New(client.Config{Endpoint: s.URL})
+	t.Cleanup(s.Close)
+	return s
+}
@@ -0,0 +1,37 @@
+package dendritetest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/laminatedio/dendrite/pkg/client"
+)
+
+func TestNewServer(t *testing.T) {
+	s := NewServer(t, map[string][]string{
+		"/services/foo/port":  {"8080"},
+		"/services/foo/hosts": {"a", "b"},
+	})
+	ctx := context.Background()
+
+	if got, err := s.Client.GetCurrent(ctx, "/services/foo/port"); err != nil || got != "8080" {
+		t.Errorf("GetCurrent() = %v, %v, want 8080", got, err)
+	}
+	if _, err := s.Client.GetCurrent(ctx, "/services/bar"); !client.IsNotFound(err) {
+		t.Errorf("GetCurrent() error = %v, want not found", err)
+	}
+
+	got, err := s.Client.Query(ctx, `{ services { foo { port hosts } } }`)
+	want := map[string]any{
+		"services": map[string]any{
+			"foo": map[string]any{
+				"port":  "8080",
+				"hosts": []any{"a", "b"},
+			},
+		},
+	}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Query() = %#v, %v, want %#v", got, err, want)
+	}
+}
@@ -0,0 +1,101 @@
+// Package server embeds the dendrite API into other programs, serving the routes of the dendrite server
+// on top of any Backend without the config file, Postgres or a separate process.
+//
+//	s := server.New(server.NewMemoryBackend(), server.Options{})
+//	http.Handle("/v1/", s)
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/laminatedio/dendrite/internal/pkg/backend"
+	"github.com/laminatedio/dendrite/internal/pkg/dendrite"
+)
+
+// Backend stores the versioned values, see NewMemoryBackend or implement it to plug in another store
+type Backend = backend.Backend
+
+type Metadata = backend.Metadata
+
+type SetOptions = backend.SetOptions
+
+type Change = backend.Change
+
+// Selection is a path and version read by Backend.GetManyPaths, a version of -1 selects the current values
+type Selection = backend.Selection
+
+// NotFoundErr is returned by backends for missing paths or versions, the server responds to it with 404
+type NotFoundErr = backend.NotFoundErr
+
+// ConflictErr is returned by backends for writes whose expected version is not the latest one, the server responds to it with 409
+type ConflictErr = backend.ConflictErr
+
+// ErrRevisionsUnsupported is returned by Backend.Revision and Backend.GetVersionsAtRevision of backends without revisions
+var ErrRevisionsUnsupported = backend.ErrRevisionsUnsupported
+
+// NewMemoryBackend returns an empty backend keeping everything in memory
+func NewMemoryBackend() Backend {
+	return backend.NewMemoryBackend()
+}
+
+type Options struct {
+	// Logger receives the logs of the routes, nothing is logged when nil
+	Logger *zap.SugaredLogger
+	// SubscriptionInterval is the interval between the checks of GraphQL subscriptions for changed values, a second when zero
+	SubscriptionInterval time.Duration
+}
+
+// Server serves the dendrite routes under /v1 on top of a backend
+type Server struct {
+	service    *dendrite.DendriteService
+	controller *dendrite.DendriteController
+	engine     *gin.Engine
+}
+
+func New(b Backend, options Options) *Server {
+	if options.Logger == nil {
+		options.Logger = zap.NewNop().Sugar()
+	}
+	if options.SubscriptionInterval <= 0 {
+		options.SubscriptionInterval = time.Second
+	}
+	service := dendrite.NewDendriteService(b)
+	s := &Server{
+		service: service,
+		controller: dendrite.NewDendriteController(
+			service,
+			options.Logger,
+			&backend.Config{Type: "embedded"},
+			&dendrite.SubscriptionConfig{Interval: options.SubscriptionInterval},
+		),
+		engine: gin.New(),
+	}
+	s.engine.Use(gin.Recovery())
+	s.RegisterRoutes(s.engine.Group("/v1"))
+	return s
+}
+
+// RegisterRoutes adds the dendrite routes to a gin router group, for programs already serving with gin
+func (s *Server) RegisterRoutes(rg *gin.RouterGroup) {
+	s.controller.RegisterControllerRoutes(rg.Group(s.controller.RoutePattern()))
+}
+
+// ServeHTTP serves the dendrite routes under /v1, like the dendrite server does
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.engine.ServeHTTP(w, r)
+}
+
+// Query runs a GraphQL query directly against the backend, without going through HTTP
+func (s *Server) Query(ctx context.Context, query string) (map[string]any, error) {
+	return s.service.Query(ctx, query)
+}
+
+// Export returns the current values of prefix and every path below it
+func (s *Server) Export(ctx context.Context, prefix string) (map[string][]string, error) {
+	return s.service.Export(ctx, prefix)
+}